@@ -0,0 +1,93 @@
+package check
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+	"github.com/mitchellh/cli"
+)
+
+// AnalysisOptions configures how provider packages are analysed for
+// references to deprecated identifiers.
+type AnalysisOptions struct {
+	// Parallelism is the maximum number of packages analysed
+	// concurrently, and of files parsed concurrently while loading
+	// them. Zero means one per CPU.
+	Parallelism int
+
+	// Stats, if set, collects timing statistics for the analysis.
+	Stats *AnalysisStats
+
+	// Toolchain runs the go tool used to build the provider. Defaults
+	// to go on PATH.
+	Toolchain *util.Toolchain
+}
+
+func (o *AnalysisOptions) toolchain() *util.Toolchain {
+	if o == nil || o.Toolchain == nil {
+		return util.NewToolchain()
+	}
+	return o.Toolchain
+}
+
+func (o *AnalysisOptions) parallelism() int {
+	if o == nil || o.Parallelism < 1 {
+		return runtime.NumCPU()
+	}
+	return o.Parallelism
+}
+
+func (o *AnalysisOptions) stats() *AnalysisStats {
+	if o == nil || o.Stats == nil {
+		// collected, but never reported
+		return &AnalysisStats{}
+	}
+	return o.Stats
+}
+
+// AnalysisStats holds timing statistics for an analysis run. Parse is
+// summed across concurrently parsed files, so it may exceed Load.
+type AnalysisStats struct {
+	mu sync.Mutex
+
+	Workers          int
+	Units            int
+	Files            int
+	ImportedPackages int
+	ImportedFiles    int
+
+	Parse time.Duration
+	Load  time.Duration
+	Total time.Duration
+}
+
+func (s *AnalysisStats) addUnit(files int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Units++
+	s.Files += files
+}
+
+func (s *AnalysisStats) addImport(files int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ImportedPackages++
+	s.ImportedFiles += files
+}
+
+func (s *AnalysisStats) addParse(parse time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Parse += parse
+}
+
+func formatAnalysisStats(ui cli.Ui, stats *AnalysisStats) {
+	ui.Output("Analysis statistics:")
+	ui.Output(fmt.Sprintf(" * analysis:         %s with %d workers", stats.Total.Round(time.Millisecond), stats.Workers))
+	ui.Output(fmt.Sprintf(" * loading:          %s, parsing %s", stats.Load.Round(time.Millisecond), stats.Parse.Round(time.Millisecond)))
+	ui.Output(fmt.Sprintf(" * provider files:   %d in %d units", stats.Files, stats.Units))
+	ui.Output(fmt.Sprintf(" * imported:         %d packages (%d files)", stats.ImportedPackages, stats.ImportedFiles))
+}
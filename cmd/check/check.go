@@ -1,6 +1,7 @@
 package check
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -9,7 +10,6 @@ import (
 	"runtime"
 	"strings"
 
-	version "github.com/hashicorp/go-version"
 	"github.com/hashicorp/tf-sdk-migrator/util"
 	"github.com/mitchellh/cli"
 )
@@ -24,6 +24,19 @@ const (
 
 	sdkModPath           = "github.com/hashicorp/terraform-plugin-sdk"
 	sdkVersionConstraint = ">=1.0.0"
+
+	sdkV2ModPath             = "github.com/hashicorp/terraform-plugin-sdk/v2"
+	sdkV2VersionConstraint   = ">=2.0.0"
+	sdkV2GoVersionConstraint = ">=1.14"
+
+	// providers should upgrade to the last v1 release first, which
+	// deprecates everything removed in v2
+	sdkV2UpgradeVersionConstraint = ">=1.17.2"
+
+	formatText  = "text"
+	formatCSV   = "csv"
+	formatJSON  = "json"
+	formatSARIF = "sarif"
 )
 
 type AlreadyMigrated struct {
@@ -45,7 +58,9 @@ func CommandFactory(ui cli.Ui) func() (cli.Command, error) {
 }
 
 func (c *command) Help() string {
-	return `Usage: tf-sdk-migrator check [--help] [--csv] [IMPORT_PATH]
+	return `Usage: tf-sdk-migrator check [--help] [--format FORMAT] [--fix] [--rules PATH]...
+       [--parallelism N] [--verbose] [--go-bin PATH] [--goflags FLAGS]
+       [--goproxy URL] [--goprivate PATTERNS] [--go-timeout DURATION] [IMPORT_PATH]
 
   Checks whether the Terraform provider at PATH is ready to be migrated to the
   new Terraform provider SDK (v1).
@@ -56,8 +71,38 @@ func (c *command) Help() string {
   By default, outputs a human-readable report and exits 0 if the provider is
   ready for migration, 1 otherwise.
 
+  If the repository contains several modules depending on the old SDK,
+  in subdirectories or as members of a go.work workspace, each of them is
+  checked and reported separately, and the exit status is 1 unless every
+  module is ready.
+
+  A provider without a go.mod of its own is checked against the go.mod of
+  the module it is part of, found in a parent directory.
+
 Options:
-  --csv    Output results in CSV format.
+  --format Output format: text (default), csv, json or sarif. The
+           json format is described in the README, sarif produces a
+           SARIF 2.1.0 log for code scanning tools.
+  --csv    Alias for --format=csv.
+  --fix    Rewrite references to deprecated identifiers which have a
+           direct replacement, and list the ones which need manual
+           attention.
+  --rules  Load a JSON ruleset file, or every *.json ruleset in a
+           directory, in addition to the built-in rules. May be
+           repeated. Later rulesets take precedence.
+  --parallelism
+           Maximum number of packages to analyse, and of files to
+           parse, concurrently. Defaults to the number of CPUs.
+  --verbose
+           Print timing statistics for the analysis.
+  --go-bin Go binary used to build the provider, whose version is
+           checked along with the go and toolchain directives in
+           go.mod. Defaults to go on PATH.
+  --goflags, --goproxy, --goprivate
+           Override GOFLAGS, GOPROXY and GOPRIVATE for the go tool.
+  --go-timeout
+           Time limit for each invocation of the go tool. Defaults to
+           10m, 0 for none.
 
 Example:
   tf-sdk-migrator check github.com/terraform-providers/terraform-provider-local
@@ -70,10 +115,36 @@ func (c *command) Synopsis() string {
 
 func (c *command) Run(args []string) int {
 	flags := flag.NewFlagSet(CommandName, flag.ExitOnError)
+	var format string
+	flags.StringVar(&format, "format", formatText, "Output format: text, csv, json or sarif")
 	var csv bool
-	flags.BoolVar(&csv, "csv", false, "CSV output")
+	flags.BoolVar(&csv, "csv", false, "CSV output, alias for --format=csv")
+	var fix bool
+	flags.BoolVar(&fix, "fix", false, "Rewrite deprecated identifiers where possible")
+	var rulesPaths util.StringSliceFlag
+	flags.Var(&rulesPaths, "rules", "Ruleset file or directory to load in addition to the built-in rules")
+	var parallelism int
+	flags.IntVar(&parallelism, "parallelism", runtime.NumCPU(), "Maximum number of packages to analyse, and of files to parse, concurrently")
+	var verbose bool
+	flags.BoolVar(&verbose, "verbose", false, "Print timing statistics")
+	tc := util.NewToolchain()
+	tc.AddFlags(flags)
 	flags.Parse(args)
 
+	if csv {
+		format = formatCSV
+	}
+	reporter, err := NewReporter(format, c.ui)
+	if err != nil {
+		c.ui.Error(err.Error())
+		return 1
+	}
+
+	if parallelism < 1 {
+		c.ui.Error(fmt.Sprintf("Invalid --parallelism %d: must be at least 1", parallelism))
+		return 1
+	}
+
 	var providerRepoName string
 	var providerPath string
 	if flags.NArg() == 1 {
@@ -95,188 +166,495 @@ func (c *command) Run(args []string) int {
 		return cli.RunResultHelp
 	}
 
-	err := runCheck(c.ui, providerPath, providerRepoName, csv)
+	var cs *util.Changeset
+	if fix {
+		cs = util.NewChangeset()
+	}
+
+	rules, err := LoadRuleset(rulesPaths)
 	if err != nil {
-		msg, alreadyMigrated := err.(*AlreadyMigrated)
-		if alreadyMigrated {
-			c.ui.Info(msg.Error())
-			return 0
+		c.ui.Error(fmt.Sprintf("Error loading rules: %s", err))
+		return 1
+	}
+
+	opts := &AnalysisOptions{Parallelism: parallelism, Toolchain: tc}
+	if verbose {
+		opts.Stats = &AnalysisStats{}
+	}
+
+	ctx, cancel := util.InterruptContext()
+	defer cancel()
+
+	results, err := CheckModules(ctx, providerPath, providerRepoName, rules, cs, opts)
+	if err != nil {
+		c.ui.Error(err.Error())
+		return 1
+	}
+	if len(results) == 1 {
+		err = reporter.Report(results[0])
+	} else {
+		err = reporter.ReportModules(providerPath, results)
+	}
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error reporting results: %s", err))
+		return 1
+	}
+
+	if fix {
+		if fixErr := c.applyFixes(cs, providerPath, format == formatText); fixErr != nil {
+			c.ui.Error(fmt.Sprintf("Error applying fixes: %s", fixErr))
+			return 1
 		}
+	}
 
-		if !csv {
-			c.ui.Error(err.Error())
+	exitCode := 0
+	for _, result := range results {
+		err := result.Err()
+		if err == nil {
+			continue
 		}
-		return 1
+		msg := err.Error()
+		if len(results) > 1 {
+			msg = fmt.Sprintf("Module %s: %s", result.ProviderName, strings.TrimSpace(msg))
+		}
+
+		if _, alreadyMigrated := err.(*AlreadyMigrated); alreadyMigrated {
+			if format == formatText {
+				c.ui.Info(msg)
+			}
+			continue
+		}
+		if format != formatCSV {
+			c.ui.Error(msg)
+		}
+		exitCode = 1
 	}
 
-	return 0
+	return exitCode
 }
 
-func RunCheck(ui cli.Ui, providerPath, repoName string) error {
-	return runCheck(ui, providerPath, repoName, false)
-}
+// applyFixes writes the fixes staged in cs to disk, journaling the
+// original files so that they can be restored with the rollback command.
+func (c *command) applyFixes(cs *util.Changeset, providerPath string, verbose bool) error {
+	changes := cs.Changes()
+	if len(changes) == 0 {
+		return nil
+	}
 
-func runCheck(ui cli.Ui, providerPath, repoName string, csv bool) error {
-	if !csv {
-		ui.Output("Checking Go runtime version ...")
+	tx, err := util.BeginTransaction(providerPath, CommandName+" --fix")
+	if err != nil {
+		return err
 	}
-	goVersion, goVersionSatisfied := CheckGoVersion(providerPath)
-	if !csv {
-		if goVersionSatisfied {
-			ui.Info(fmt.Sprintf("Go version %s: OK.", goVersion))
-		} else {
-			ui.Warn(fmt.Sprintf("Go version does not satisfy constraint %s. Found Go version: %s.", goVersionConstraint, goVersion))
+	err = tx.Apply(cs)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%s\nError rolling back changes: %s", err, rbErr)
 		}
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
 	}
 
-	if !csv {
-		ui.Output("Checking whether provider uses Go modules...")
+	if verbose {
+		c.ui.Info(fmt.Sprintf("Rewrote %d files. To undo, use `tf-sdk-migrator rollback`.", len(changes)))
 	}
-	goModulesUsed := CheckForGoModules(providerPath)
-	if !csv {
-		if goModulesUsed {
-			ui.Info("Go modules in use: OK.")
-		} else {
-			ui.Warn("Go modules not in use. Provider must use Go modules.")
+	return nil
+}
+
+// RunCheck checks the provider at providerPath, running the go tool
+// through tc, and prints a human-readable report to ui. The returned
+// error is set if the check could not be run or the provider cannot be
+// migrated, see CheckResult.Err.
+func RunCheck(ctx context.Context, ui cli.Ui, tc *util.Toolchain, providerPath, repoName string, rules *Ruleset) (*CheckResult, error) {
+	return TargetSDKv1.RunCheck(ctx, ui, tc, providerPath, repoName, rules)
+}
+
+// RunCheckAndFix is like RunCheck, but automatically fixes references to
+// deprecated identifiers where possible, staging the changes in cs.
+// Fixed references do not count against the eligibility of the provider.
+func RunCheckAndFix(ctx context.Context, ui cli.Ui, tc *util.Toolchain, cs *util.Changeset, providerPath, repoName string, rules *Ruleset) (*CheckResult, error) {
+	return TargetSDKv1.runCheck(ctx, ui, tc, providerPath, repoName, rules, cs)
+}
+
+// RunCheck is like the RunCheck function, but checks whether the
+// provider is ready for the migration t.
+func (t *Target) RunCheck(ctx context.Context, ui cli.Ui, tc *util.Toolchain, providerPath, repoName string, rules *Ruleset) (*CheckResult, error) {
+	return t.runCheck(ctx, ui, tc, providerPath, repoName, rules, nil)
+}
+
+func (t *Target) runCheck(ctx context.Context, ui cli.Ui, tc *util.Toolchain, providerPath, repoName string, rules *Ruleset, cs *util.Changeset) (*CheckResult, error) {
+	result, err := t.Check(ctx, providerPath, repoName, rules, cs, &AnalysisOptions{Toolchain: tc})
+	if err != nil {
+		return nil, err
+	}
+	err = NewHumanReporter(ui).Report(result)
+	if err != nil {
+		return result, err
+	}
+	return result, result.Err()
+}
+
+// CheckModules checks every module in the repository at providerPath
+// which depends on Terraform or the SDK, including the members of a
+// go.work workspace, see util.FindModules. Each module is named after
+// its module path, unless it is the only one. If no module depends on
+// either, providerPath itself is checked, so that the reason is
+// reported.
+func CheckModules(ctx context.Context, providerPath, repoName string, rules *Ruleset, cs *util.Changeset, opts *AnalysisOptions) ([]*CheckResult, error) {
+	return TargetSDKv1.CheckModules(ctx, providerPath, repoName, rules, cs, opts)
+}
+
+// CheckModules is like the CheckModules function, but checks the
+// modules which depend on either SDK generation of the migration t.
+func (t *Target) CheckModules(ctx context.Context, providerPath, repoName string, rules *Ruleset, cs *util.Changeset, opts *AnalysisOptions) ([]*CheckResult, error) {
+	modules, err := util.FindModules(providerPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error finding modules in %s: %s", providerPath, err)
+	}
+
+	fromModPath, toModPath := t.From.ModulePath(), t.To.ModulePath()
+	var providerModules []*util.Module
+	for _, m := range modules {
+		usesFrom, err := util.RequiresModule(m.Dir, fromModPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading go.mod of module %s: %s", m.Path, err)
 		}
+		usesTo, err := util.RequiresModule(m.Dir, toModPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading go.mod of module %s: %s", m.Path, err)
+		}
+		if !usesFrom && !usesTo {
+			log.Printf("[INFO] Skipping module %s in %s, which depends on neither %s nor %s", m.Path, m.Dir, fromModPath, toModPath)
+			continue
+		}
+		providerModules = append(providerModules, m)
 	}
 
-	if !csv {
-		ui.Output(fmt.Sprintf("Checking version of %s to determine if provider was already migrated...", sdkModPath))
+	if len(providerModules) <= 1 {
+		dir := providerPath
+		if len(providerModules) == 1 {
+			dir = providerModules[0].Dir
+		}
+		result, err := t.Check(ctx, dir, repoName, rules, cs, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []*CheckResult{result}, nil
 	}
-	sdkVersion, sdkVersionSatisfied, err := CheckDependencyVersion(providerPath, sdkModPath, sdkVersionConstraint)
-	if err != nil {
-		return fmt.Errorf("Error getting SDK version for provider %s: %s", providerPath, err)
-	}
-	if !csv {
-		if sdkVersionSatisfied {
-			return &AlreadyMigrated{sdkVersion}
-		} else if sdkVersion != "" {
-			return fmt.Errorf("Provider already migrated, but SDK version %s does not satisfy constraint %s.",
-				sdkVersion, sdkVersionConstraint)
+
+	results := make([]*CheckResult, 0, len(providerModules))
+	for _, m := range providerModules {
+		result, err := t.Check(ctx, m.Dir, m.Path, rules, cs, opts)
+		if err != nil {
+			return nil, fmt.Errorf("Module %s: %s", m.Path, err)
 		}
+		results = append(results, result)
 	}
+	return results, nil
+}
 
-	if !csv {
-		ui.Output(fmt.Sprintf("Checking version of %s used in provider...", tfModPath))
+// Check checks whether the provider at providerPath can be migrated to
+// the SDK. If cs is not nil, references to deprecated identifiers are
+// fixed where possible and the changes staged in cs; fixed references do
+// not count against the verdict. An error is only returned if the check
+// could not be run, e.g. because ctx was cancelled.
+func Check(ctx context.Context, providerPath, repoName string, rules *Ruleset, cs *util.Changeset, opts *AnalysisOptions) (*CheckResult, error) {
+	return TargetSDKv1.Check(ctx, providerPath, repoName, rules, cs, opts)
+}
+
+// Check is like the Check function, but checks whether the provider can
+// be migrated from t.From to t.To, using rules for t.
+func (t *Target) Check(ctx context.Context, providerPath, repoName string, rules *Ruleset, cs *util.Changeset, opts *AnalysisOptions) (*CheckResult, error) {
+	result := &CheckResult{
+		ProviderPath:           providerPath,
+		ProviderName:           repoName,
+		Target:                 t,
+		Go:                     VersionCheck{Constraint: t.GoVersionConstraint},
+		GoDirective:            VersionCheck{Constraint: t.GoVersionConstraint},
+		GoToolchain:            VersionCheck{Constraint: t.GoVersionConstraint},
+		ModuleDirectives:       []*ModuleDirectiveUse{},
+		TransitiveDependencies: []*DependencyChain{},
+		RemovedPackagesInUse:   []*RemovedPackageUse{},
+		Offences:               []*Offence{},
+		FixedOffences:          []*Offence{},
+	}
+	result.versionCheck(t.From).Constraint = t.FromVersionConstraint
+	result.versionCheck(t.To).Constraint = t.ToVersionConstraint
+	if opts != nil {
+		result.Stats = opts.Stats
 	}
-	tfVersion, tfVersionSatisfied, err := CheckDependencyVersion(providerPath, tfModPath, tfVersionConstraint)
+	fromModPath, toModPath := t.From.ModulePath(), t.To.ModulePath()
+	fromCheck, toCheck := versionSubCheck(t.From), versionSubCheck(t.To)
+
+	// a provider may be a subdirectory of a larger module, whose go.mod
+	// applies to it
+	moduleDir := providerPath
+	enclosing, err := util.FindEnclosingModule(providerPath)
 	if err != nil {
-		return fmt.Errorf("Error getting Terraform version for provider %s: %s", providerPath, err)
+		return nil, fmt.Errorf("Error finding go.mod for provider %s: %s", providerPath, err)
 	}
-	if !csv {
-		if tfVersionSatisfied {
-			ui.Info(fmt.Sprintf("Terraform version %s: OK.", tfVersion))
-		} else if tfVersion != "" {
-			ui.Warn(fmt.Sprintf("Terraform version does not satisfy constraint %s. Found Terraform version: %s", tfVersionConstraint, tfVersion))
-		} else {
-			return fmt.Errorf("This directory (%s) doesn't seem to be a Terraform provider.\nProviders depend on %s", providerPath, tfModPath)
+	var sharedModule bool
+	if enclosing != nil {
+		moduleDir = enclosing.Dir
+		absProviderPath, err := filepath.Abs(providerPath)
+		if err != nil {
+			return nil, err
 		}
+		sharedModule = enclosing.Dir != absProviderPath
 	}
 
-	if !csv {
-		ui.Output("Checking whether provider uses deprecated SDK packages or identifiers...")
+	goVersions := CheckGoVersion(ctx, moduleDir, opts.toolchain(), t.GoVersionConstraint)
+	result.Go, result.GoDirective, result.GoToolchain = goVersions.Binary, goVersions.Directive, goVersions.Toolchain
+	if goVersions.Binary.Version == "" {
+		result.addCheck(SubCheckGoVersion, SeverityWarning, false,
+			fmt.Sprintf("Could not determine the version of %s.", opts.toolchain().GoBinary()))
+	} else if goVersions.Binary.Satisfied {
+		result.addCheck(SubCheckGoVersion, SeverityWarning, true, fmt.Sprintf("Go version %s: OK.", goVersions.Binary.Version))
+	} else {
+		result.addCheck(SubCheckGoVersion, SeverityWarning, false,
+			fmt.Sprintf("Go version does not satisfy constraint %s. Found Go version: %s.", t.GoVersionConstraint, goVersions.Binary.Version))
+	}
+	if goVersions.Directive.Version == "" {
+		result.addSkippedCheck(SubCheckGoDirective, SeverityWarning, "No go directive in go.mod.")
+	} else if goVersions.Directive.Satisfied {
+		result.addCheck(SubCheckGoDirective, SeverityWarning, true,
+			fmt.Sprintf("go directive %s in go.mod: OK.", goVersions.Directive.Version))
+	} else {
+		result.addCheck(SubCheckGoDirective, SeverityWarning, false,
+			fmt.Sprintf("go directive in go.mod does not satisfy constraint %s. Found: go %s.", t.GoVersionConstraint, goVersions.Directive.Version))
+	}
+	if goVersions.Toolchain.Version == "" {
+		result.addSkippedCheck(SubCheckGoToolchain, SeverityWarning, "No toolchain directive in go.mod.")
+	} else if goVersions.Toolchain.Satisfied {
+		result.addCheck(SubCheckGoToolchain, SeverityWarning, true,
+			fmt.Sprintf("toolchain directive go%s in go.mod: OK.", goVersions.Toolchain.Version))
+	} else {
+		result.addCheck(SubCheckGoToolchain, SeverityWarning, false,
+			fmt.Sprintf("toolchain directive in go.mod does not satisfy constraint %s. Found: toolchain go%s.", t.GoVersionConstraint, goVersions.Toolchain.Version))
+	}
+
+	result.GoModules = CheckForGoModules(providerPath)
+	if result.GoModules && sharedModule {
+		result.addCheck(SubCheckGoModules, SeverityError, true,
+			fmt.Sprintf("Go modules in use (provider is part of module %s in %s): OK.", enclosing.Path, enclosing.Dir))
+	} else if result.GoModules {
+		result.addCheck(SubCheckGoModules, SeverityError, true, "Go modules in use: OK.")
+	} else {
+		result.addCheck(SubCheckGoModules, SeverityError, false, "Go modules not in use. Provider must use Go modules.")
 	}
-	removedPackagesInUse, removedIdentsInUse, err := CheckSDKPackageImportsAndRefs(providerPath)
+
+	sdkVersion, sdkVersionSatisfied, err := CheckDependencyVersion(moduleDir, toModPath, t.ToVersionConstraint)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("Error getting %s version for provider %s: %s", t.To.displayName(), providerPath, err)
 	}
-	usesRemovedPackagesOrIdents := len(removedPackagesInUse) > 0 || len(removedIdentsInUse) > 0
-	if !csv {
+	toVersion := result.versionCheck(t.To)
+	toVersion.Version, toVersion.Satisfied = sdkVersion, sdkVersionSatisfied
+	// other packages of a shared module may have been migrated before the
+	// provider, which is only migrated once the module no longer depends
+	// on the generation migrated from
+	partlyMigrated := false
+	if sharedModule && sdkVersion != "" {
+		partlyMigrated, err = util.RequiresModule(moduleDir, fromModPath)
 		if err != nil {
-			return fmt.Errorf("Error determining use of deprecated SDK packages and identifiers: %s", err)
+			return nil, fmt.Errorf("Error getting %s version for provider %s: %s", t.From.displayName(), providerPath, err)
 		}
-		if !usesRemovedPackagesOrIdents {
-			ui.Info("No imports of deprecated SDK packages or identifiers: OK.")
+	}
+	if partlyMigrated {
+		result.addCheck(toCheck, SeverityError, true,
+			fmt.Sprintf("Module %s depends on %s version %s, but also on %s: OK.", enclosing.Path, t.To.displayName(), sdkVersion, fromModPath))
+	} else if sdkVersionSatisfied {
+		result.addCheck(toCheck, SeverityError, true,
+			fmt.Sprintf("Provider already migrated to %s version %s", t.To.displayName(), sdkVersion))
+
+		// a partial upgrade or a bad merge may leave imports of several
+		// SDK generations behind
+		details, err := LoadProviderPackages(ctx, cs, providerPath, false, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			log.Printf("[WARN] Could not list packages of %s to check SDK generations: %s", providerPath, err)
+		} else {
+			addSDKGenerationsCheck(result, details)
 		}
-		formatRemovedPackages(ui, removedPackagesInUse)
-		formatRemovedIdents(ui, removedIdentsInUse)
+
+		result.skipRemaining()
+		if sc := result.SubCheck(SubCheckSDKGenerations); sc != nil && sc.Status == StatusFailed {
+			result.setVerdict()
+		} else {
+			result.Verdict = VerdictAlreadyMigrated
+		}
+		return result, nil
+	} else if sdkVersion != "" {
+		result.addCheck(toCheck, SeverityError, false,
+			fmt.Sprintf("Provider already migrated, but %s version %s does not satisfy constraint %s.", t.To.displayName(), sdkVersion, t.ToVersionConstraint))
+		result.skipRemaining()
+		result.setVerdict()
+		return result, nil
+	} else {
+		result.addCheck(toCheck, SeverityError, true, fmt.Sprintf("Provider does not depend on %s yet.", toModPath))
 	}
-	constraintsSatisfied := goVersionSatisfied && goModulesUsed && tfVersionSatisfied && !usesRemovedPackagesOrIdents
-	if csv {
-		ui.Output(fmt.Sprintf("go_version,go_version_satisfies_constraint,uses_go_modules,sdk_version,sdk_version_satisfies_constraint,does_not_use_removed_packages,all_constraints_satisfied\n%s,%t,%t,%s,%t,%t,%t",
-			goVersion, goVersionSatisfied, goModulesUsed, tfVersion, tfVersionSatisfied, !usesRemovedPackagesOrIdents, constraintsSatisfied))
+
+	fromVersion, fromVersionSatisfied, err := CheckDependencyVersion(moduleDir, fromModPath, t.FromVersionConstraint)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting %s version for provider %s: %s", t.From.displayName(), providerPath, err)
+	}
+	from := result.versionCheck(t.From)
+	from.Version, from.Satisfied = fromVersion, fromVersionSatisfied
+	if fromVersionSatisfied {
+		result.addCheck(fromCheck, SeverityError, true, fmt.Sprintf("%s version %s: OK.", t.From.displayName(), fromVersion))
+	} else if fromVersion != "" {
+		result.addCheck(fromCheck, SeverityError, false,
+			fmt.Sprintf("%s version does not satisfy constraint %s. Found %s version: %s",
+				t.From.displayName(), t.FromVersionConstraint, t.From.displayName(), fromVersion))
 	} else {
-		var prettyProviderName string
-		if repoName != "" {
-			prettyProviderName = " " + repoName
+		// a provider which was not migrated to the SDK yet cannot be
+		// upgraded to its next major version
+		usesTerraform := false
+		if t.From != GenerationTerraform {
+			usesTerraform, err = util.RequiresModule(moduleDir, tfModPath)
+			if err != nil {
+				return nil, fmt.Errorf("Error getting Terraform version for provider %s: %s", providerPath, err)
+			}
 		}
-		if constraintsSatisfied {
-			ui.Info(fmt.Sprintf("\nAll constraints satisfied. Provider%s can be migrated to the new SDK.\n", prettyProviderName))
-			return nil
-		} else if goModulesUsed && tfVersionSatisfied && !usesRemovedPackagesOrIdents {
-			ui.Info(fmt.Sprintf("\nProvider%s can be migrated to the new SDK, but Go version %s is recommended.\n", prettyProviderName, goVersionConstraint))
-			return nil
+		if usesTerraform {
+			result.addCheck(fromCheck, SeverityError, false,
+				fmt.Sprintf("Provider still depends on %s.\nMigrate it to %s with tf-sdk-migrator %s first.",
+					tfModPath, fromModPath, TargetSDKv1.Command))
+		} else {
+			result.addCheck(fromCheck, SeverityError, false,
+				fmt.Sprintf("This directory (%s) doesn't seem to be a Terraform provider.\nProviders depend on %s", providerPath, fromModPath))
 		}
+		result.skipRemaining()
+		result.setVerdict()
+		return result, nil
 	}
 
-	return fmt.Errorf("\nSome constraints not satisfied. Please resolve these before migrating to the new SDK.")
-}
-
-func formatRemovedPackages(ui cli.Ui, removedPackagesInUse []string) {
-	if len(removedPackagesInUse) == 0 {
-		return
+	result.ModuleDirectives, err = CheckModuleDirectives(moduleDir, t)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading replace and exclude directives for provider %s: %s", providerPath, err)
 	}
-
-	ui.Warn("Deprecated SDK packages in use:")
-	for _, pkg := range removedPackagesInUse {
-		ui.Warn(fmt.Sprintf(" * %s", pkg))
+	if len(result.ModuleDirectives) == 0 {
+		result.addCheck(SubCheckModuleDirectives, SeverityWarning, true,
+			fmt.Sprintf("No replace or exclude directives for %s or %s: OK.", fromModPath, toModPath))
+	} else {
+		result.addCheck(SubCheckModuleDirectives, SeverityWarning, false,
+			fmt.Sprintf("%d replace or exclude directives in go.mod need attention.", len(result.ModuleDirectives)))
 	}
-}
 
-func formatRemovedIdents(ui cli.Ui, removedIdentsInUse []*Offence) {
-	if len(removedIdentsInUse) == 0 {
-		return
+	deps, err := CheckTransitiveDependencies(ctx, opts.toolchain(), moduleDir, fromModPath)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("[WARN] Could not load module graph of %s: %s", moduleDir, err)
+		result.addSkippedCheck(SubCheckTransitiveDeps, SeverityError,
+			fmt.Sprintf("Could not load the module graph to check dependencies on %s:\n%s", fromModPath, err))
+	} else if len(deps) == 0 {
+		result.addCheck(SubCheckTransitiveDeps, SeverityError, true, fmt.Sprintf("No dependencies depend on %s: OK.", fromModPath))
+	} else {
+		result.TransitiveDependencies = deps
+		result.addCheck(SubCheckTransitiveDeps, SeverityError, false,
+			fmt.Sprintf("%d dependencies still depend on %s.", len(deps), fromModPath))
 	}
-	ui.Warn("Deprecated SDK identifiers in use:")
-	for _, ident := range removedIdentsInUse {
-		d := ident.IdentDeprecation
-		ui.Warn(fmt.Sprintf(" * %s (%s)", d.Identifier.Name, d.ImportPath))
 
-		for _, pos := range ident.Positions {
-			ui.Warn(fmt.Sprintf("   * %s", pos))
-		}
+	details, err := LoadProviderPackages(ctx, cs, providerPath, true, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Error determining use of deprecated SDK packages and identifiers: %s", err)
 	}
-}
 
-func CheckGoVersion(providerPath string) (goVersion string, satisfiesConstraint bool) {
-	c, err := version.NewConstraint(goVersionConstraint)
+	addSDKGenerationsCheck(result, details)
 
-	runtimeVersion := strings.TrimLeft(runtime.Version(), "go")
-	v, err := version.NewVersion(runtimeVersion)
+	removedPackagesInUse, err := CheckSDKPackageImports(details, rules)
 	if err != nil {
-		log.Printf("[WARN] Could not parse Go version %s", runtimeVersion)
-		return "", false
+		return nil, fmt.Errorf("Error determining use of deprecated SDK packages and identifiers: %s", err)
+	}
+	// fixes may remove imports, so their positions are taken first
+	positions := details.importPositions(removedPackagesInUse)
+	for _, pkg := range removedPackagesInUse {
+		result.RemovedPackagesInUse = append(result.RemovedPackagesInUse, &RemovedPackageUse{
+			ImportPath: pkg,
+			Rule:       rules.RemovedPackage(pkg),
+			Positions:  positions[pkg],
+		})
+	}
+
+	if cs != nil {
+		result.FixedOffences, result.Offences, err = FixSDKPackageRefs(details, rules, opts)
+	} else {
+		result.Offences, err = CheckSDKPackageRefs(details, rules, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error determining use of deprecated SDK packages and identifiers: %s", err)
+	}
+
+	if len(removedPackagesInUse) == 0 {
+		result.addCheck(SubCheckRemovedPackages, SeverityError, true, "No imports of deprecated SDK packages: OK.")
+	} else {
+		result.addCheck(SubCheckRemovedPackages, SeverityError, false,
+			fmt.Sprintf("%d deprecated SDK packages in use.", len(removedPackagesInUse)))
+	}
+	if len(result.Offences) == 0 {
+		result.addCheck(SubCheckRemovedIdentifiers, SeverityError, true, "No references to deprecated SDK identifiers: OK.")
+	} else {
+		result.addCheck(SubCheckRemovedIdentifiers, SeverityError, false,
+			fmt.Sprintf("%d deprecated SDK identifiers in use.", len(result.Offences)))
 	}
 
-	return runtimeVersion, c.Check(v)
+	result.setVerdict()
+	return result, nil
 }
 
+// CheckForGoModules reports whether the provider at providerPath is
+// part of a Go module, which may be rooted in a parent directory.
 func CheckForGoModules(providerPath string) (usingModules bool) {
-	if _, err := os.Stat(filepath.Join(providerPath, "go.mod")); err != nil {
+	m, err := util.FindEnclosingModule(providerPath)
+	if err != nil || m == nil {
 		log.Printf("[WARN] 'go.mod' file not found - provider %s is not using Go modules", providerPath)
 		return false
 	}
 	return true
 }
 
-func CheckSDKPackageImportsAndRefs(providerPath string) (removedPackagesInUse []string, packageRefsOffences []*Offence, err error) {
-	var providerImportDetails *ProviderImportDetails
-
-	providerImportDetails, err = GoListPackageImports(providerPath)
+func CheckSDKPackageImportsAndRefs(ctx context.Context, providerPath string, rules *Ruleset, opts *AnalysisOptions) (removedPackagesInUse []string, packageRefsOffences []*Offence, err error) {
+	providerImportDetails, err := LoadProviderPackages(ctx, nil, providerPath, true, opts)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	removedPackagesInUse, err = CheckSDKPackageImports(providerImportDetails)
+	removedPackagesInUse, err = CheckSDKPackageImports(providerImportDetails, rules)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	packageRefsOffences, err = CheckSDKPackageRefs(providerImportDetails)
+	packageRefsOffences, err = CheckSDKPackageRefs(providerImportDetails, rules, opts)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	return
 }
+
+// FixSDKPackageImportsAndRefs is like CheckSDKPackageImportsAndRefs, but
+// fixes references to deprecated identifiers where possible, staging the
+// changes in cs, and reports the fixed references separately.
+func FixSDKPackageImportsAndRefs(ctx context.Context, cs *util.Changeset, providerPath string, rules *Ruleset, opts *AnalysisOptions) (removedPackagesInUse []string, fixedRefs []*Offence, packageRefsOffences []*Offence, err error) {
+	providerImportDetails, err := LoadProviderPackages(ctx, cs, providerPath, true, opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	removedPackagesInUse, err = CheckSDKPackageImports(providerImportDetails, rules)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	fixedRefs, packageRefsOffences, err = FixSDKPackageRefs(providerImportDetails, rules, opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return
+}
@@ -0,0 +1,60 @@
+package check
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+	"golang.org/x/mod/module"
+)
+
+// DependencyChain is a dependency of the provider which requires a
+// module, such as the old SDK, along with the chain of requirements
+// leading to it.
+type DependencyChain struct {
+	// Module is the dependency requiring the module.
+	Module module.Version
+
+	// Chain starts with the provider's module and ends with the
+	// required module, as required by Module.
+	Chain []module.Version
+}
+
+// String formats the chain as path@version elements separated by
+// arrows.
+func (dc *DependencyChain) String() string {
+	return strings.Join(dc.chainStrings(), " -> ")
+}
+
+// chainStrings returns the elements of the chain as path@version, or
+// just the path for the provider's module.
+func (dc *DependencyChain) chainStrings() []string {
+	elems := make([]string, 0, len(dc.Chain))
+	for _, m := range dc.Chain {
+		if m.Version == "" {
+			elems = append(elems, m.Path)
+		} else {
+			elems = append(elems, m.Path+"@"+m.Version)
+		}
+	}
+	return elems
+}
+
+// CheckTransitiveDependencies returns the dependencies in the module
+// graph of the module at modulePath which still require modPath, other
+// than the module itself.
+func CheckTransitiveDependencies(ctx context.Context, tc *util.Toolchain, modulePath, modPath string) ([]*DependencyChain, error) {
+	g, err := util.LoadModuleGraph(ctx, tc, modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var deps []*DependencyChain
+	for _, chain := range g.ChainsTo(modPath) {
+		deps = append(deps, &DependencyChain{
+			Module: chain[len(chain)-2],
+			Chain:  chain,
+		})
+	}
+	return deps, nil
+}
@@ -0,0 +1,127 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/tf-sdk-migrator/util"
+	"golang.org/x/mod/modfile"
+)
+
+// GoVersionCheck holds the Go versions relevant to building a provider,
+// each checked against the Go version constraint. A version is empty if
+// it could not be determined or is not set.
+type GoVersionCheck struct {
+	// Binary is the version of the go binary used to build the provider.
+	Binary VersionCheck
+
+	// Directive is the go directive of the provider's go.mod, the
+	// minimum Go version the provider requires.
+	Directive VersionCheck
+
+	// Toolchain is the toolchain directive of the provider's go.mod,
+	// the Go toolchain the provider should be built with.
+	Toolchain VersionCheck
+}
+
+// CheckGoVersion checks the version of the go binary run by tc, and the
+// go and toolchain directives in the go.mod of the provider at
+// providerPath, against the Go version constraint of the migration.
+func CheckGoVersion(ctx context.Context, providerPath string, tc *util.Toolchain, constraint string) *GoVersionCheck {
+	c, err := version.NewConstraint(constraint)
+	if err != nil {
+		panic(err)
+	}
+
+	check := func(v string) VersionCheck {
+		vc := VersionCheck{Version: v, Constraint: constraint}
+		if v == "" {
+			return vc
+		}
+		parsed, err := version.NewVersion(goReleaseVersion(v))
+		if err != nil {
+			log.Printf("[WARN] Could not parse Go version %s", v)
+			return vc
+		}
+		vc.Satisfied = c.Check(parsed)
+		return vc
+	}
+
+	result := &GoVersionCheck{}
+
+	binaryVersion, err := GoBinaryVersion(ctx, tc)
+	if err != nil {
+		log.Printf("[WARN] Could not determine version of %s: %s", tc.GoBinary(), err)
+	}
+	result.Binary = check(binaryVersion)
+
+	directive, toolchain, err := ReadGoDirectives(providerPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("[WARN] Could not read go directives: %s", err)
+	}
+	result.Directive = check(directive)
+	result.Toolchain = check(strings.TrimPrefix(toolchain, "go"))
+
+	return result
+}
+
+// goReleaseVersion returns the release a Go version such as 1.22rc1
+// or 1.21-a1b2c3 belongs to, since constraints never match prereleases.
+func goReleaseVersion(v string) string {
+	if i := strings.IndexFunc(v, func(r rune) bool {
+		return r != '.' && (r < '0' || r > '9')
+	}); i >= 0 {
+		v = v[:i]
+	}
+	return strings.TrimSuffix(v, ".")
+}
+
+// GoBinaryVersion returns the version of the go binary run by tc,
+// without the "go" prefix. Automatic toolchain switching is disabled, so
+// that the version of the binary itself is reported.
+func GoBinaryVersion(ctx context.Context, tc *util.Toolchain) (string, error) {
+	out, err := tc.WithEnv("GOTOOLCHAIN=local").Run(ctx, "", "version")
+	if err != nil {
+		return "", err
+	}
+
+	// go version go1.13.4 linux/amd64
+	// go version devel go1.23-a1b2c3d4 Tue Jan 1 00:00:00 2024 +0000 linux/amd64
+	fields := strings.Fields(string(out))
+	if len(fields) > 3 && fields[2] == "devel" {
+		fields = append(fields[:2], fields[3:]...)
+	}
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "go") {
+		return "", fmt.Errorf("unexpected output: %q", strings.TrimSpace(string(out)))
+	}
+	return strings.TrimPrefix(fields[2], "go"), nil
+}
+
+// ReadGoDirectives returns the arguments of the go and toolchain
+// directives in the go.mod of the provider at providerPath, or empty
+// strings if they are not set.
+func ReadGoDirectives(providerPath string) (goVersion, toolchain string, err error) {
+	goModPath := filepath.Join(providerPath, "go.mod")
+	content, err := ioutil.ReadFile(goModPath)
+	if err != nil {
+		return "", "", err
+	}
+	pf, err := modfile.Parse(goModPath, content, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	if pf.Go != nil {
+		goVersion = pf.Go.Version
+	}
+	if pf.Toolchain != nil {
+		toolchain = pf.Toolchain.Name
+	}
+	return goVersion, toolchain, nil
+}
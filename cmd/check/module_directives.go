@@ -0,0 +1,64 @@
+package check
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+)
+
+// ModuleDirectiveUse is a replace or exclude directive in go.mod which
+// needs attention when migrating, along with the reason.
+type ModuleDirectiveUse struct {
+	Directive *util.ModuleDirective
+	Message   string
+}
+
+// CheckModuleDirectives returns the replace and exclude directives in
+// the go.mod of the module at modulePath which affect the migration t:
+// those for the module migrated from, which become stale once it is no
+// longer required, and replacements of every version of the module
+// migrated to, which shadow the version the provider is migrated to.
+func CheckModuleDirectives(modulePath string, t *Target) ([]*ModuleDirectiveUse, error) {
+	uses := []*ModuleDirectiveUse{}
+	fromModPath, toModPath := t.From.ModulePath(), t.To.ModulePath()
+
+	fromDirectives, err := util.ReadModuleDirectives(modulePath, fromModPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range fromDirectives {
+		var msg string
+		switch {
+		case d.Kind == "exclude":
+			msg = fmt.Sprintf("Stale once %s is no longer required, removed by %s.", fromModPath, t.Command)
+		case d.IsLocal():
+			msg = fmt.Sprintf("Local copy of %s, which is no longer used after %s; removed by %s. "+
+				"Pass a local copy of %s to %s --replace-fork to use one instead.", fromModPath, t.Migrating, t.Command, toModPath, t.Command)
+		default:
+			msg = fmt.Sprintf("Fork of %s, removed by %s unless the equivalent fork of %s is passed to --replace-fork",
+				fromModPath, t.Command, toModPath)
+			if fork := util.EquivalentFork(fromModPath, toModPath, d.New.Path); fork != "" {
+				msg += fmt.Sprintf(", e.g. --replace-fork %s@VERSION", fork)
+			}
+			msg += "."
+		}
+		uses = append(uses, &ModuleDirectiveUse{Directive: d, Message: msg})
+	}
+
+	toDirectives, err := util.ReadModuleDirectives(modulePath, toModPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range toDirectives {
+		if d.Kind != "replace" || d.Old.Version != "" {
+			continue
+		}
+		msg := fmt.Sprintf("Replaces every version of %s, so the SDK version migrated to has no effect.", toModPath)
+		if d.IsLocal() {
+			msg = fmt.Sprintf("Local copy of %s, which shadows the SDK version migrated to.", toModPath)
+		}
+		uses = append(uses, &ModuleDirectiveUse{Directive: d, Message: msg})
+	}
+
+	return uses, nil
+}
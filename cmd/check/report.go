@@ -0,0 +1,285 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// Reporter renders the result of a check.
+type Reporter interface {
+	Report(result *CheckResult) error
+
+	// ReportModules renders the results of checking several modules in
+	// the repository at providerPath.
+	ReportModules(providerPath string, results []*CheckResult) error
+}
+
+// NewReporter returns the reporter for the given output format: text,
+// csv, json or sarif. Machine-readable formats are written to ui without
+// colors.
+func NewReporter(format string, ui cli.Ui) (Reporter, error) {
+	if format != formatText {
+		if cu, ok := ui.(*cli.ColoredUi); ok {
+			ui = cu.Ui
+		}
+	}
+
+	switch format {
+	case formatText:
+		return NewHumanReporter(ui), nil
+	case formatCSV:
+		return NewCSVReporter(ui), nil
+	case formatJSON:
+		return NewJSONReporter(ui), nil
+	case formatSARIF:
+		return NewSARIFReporter(ui), nil
+	}
+	return nil, fmt.Errorf("Invalid --format %q: must be text, csv, json or sarif", format)
+}
+
+type humanReporter struct {
+	ui cli.Ui
+}
+
+// NewHumanReporter returns a reporter printing a human-readable report.
+func NewHumanReporter(ui cli.Ui) Reporter {
+	return &humanReporter{ui}
+}
+
+func (r *humanReporter) Report(result *CheckResult) error {
+	ui := r.ui
+	t := result.target()
+	fromModPath, toModPath := t.From.ModulePath(), t.To.ModulePath()
+
+	for _, sc := range result.Checks {
+		if sc.Status == StatusSkipped && !(sc.Name == SubCheckTransitiveDeps && sc.Details != "") {
+			continue
+		}
+
+		switch sc.Name {
+		case SubCheckGoVersion:
+			ui.Output("Checking Go version ...")
+		case SubCheckGoModules:
+			ui.Output("Checking whether provider uses Go modules...")
+		case versionSubCheck(t.To):
+			ui.Output(fmt.Sprintf("Checking version of %s to determine if provider was already migrated...", toModPath))
+			if sc.Status == StatusPassed && result.versionCheck(t.To).Version != "" && result.Verdict != VerdictAlreadyMigrated {
+				// the module the provider is part of was partly migrated
+				ui.Info(sc.Details)
+			}
+			// otherwise reported through CheckResult.Err
+			continue
+		case versionSubCheck(t.From):
+			ui.Output(fmt.Sprintf("Checking version of %s used in provider...", fromModPath))
+			if result.versionCheck(t.From).Version == "" {
+				// reported through CheckResult.Err
+				continue
+			}
+		case SubCheckModuleDirectives:
+			ui.Output("Checking replace and exclude directives in go.mod...")
+			if sc.Status == StatusFailed {
+				ui.Warn(sc.Details)
+				formatModuleDirectives(ui, result.ModuleDirectives)
+				continue
+			}
+		case SubCheckTransitiveDeps:
+			ui.Output(fmt.Sprintf("Checking whether dependencies depend on %s...", fromModPath))
+			if sc.Status == StatusSkipped {
+				ui.Warn(sc.Details)
+				continue
+			}
+			formatTransitiveDependencies(ui, fromModPath, result.TransitiveDependencies)
+			if sc.Status == StatusFailed {
+				continue
+			}
+		case SubCheckSDKGenerations:
+			ui.Output("Checking whether provider mixes SDK generations...")
+			if sc.Status == StatusFailed {
+				ui.Warn(sc.Details)
+				formatSDKGenerations(ui, result.SDKGenerations)
+				continue
+			}
+		case SubCheckRemovedPackages:
+			ui.Output("Checking whether provider uses deprecated SDK packages or identifiers...")
+			if len(result.RemovedPackagesInUse) == 0 && len(result.Offences) == 0 {
+				ui.Info("No imports of deprecated SDK packages or identifiers: OK.")
+			}
+			formatFixedIdents(ui, result.FixedOffences)
+			formatRemovedPackages(ui, result.RemovedPackagesInUse)
+			continue
+		case SubCheckRemovedIdentifiers:
+			formatRemovedIdents(ui, result.Offences)
+			if result.Stats != nil {
+				formatAnalysisStats(ui, result.Stats)
+			}
+			continue
+		}
+
+		if sc.Status == StatusPassed {
+			ui.Info(sc.Details)
+		} else {
+			ui.Warn(sc.Details)
+		}
+	}
+
+	var prettyProviderName string
+	if result.ProviderName != "" {
+		prettyProviderName = " " + result.ProviderName
+	}
+	switch result.Verdict {
+	case VerdictReady:
+		ui.Info(fmt.Sprintf("\nAll constraints satisfied. Provider%s can be %s.\n", prettyProviderName, t.Migrated))
+	case VerdictReadyWithWarnings:
+		if sc := result.SubCheck(SubCheckModuleDirectives); sc != nil && sc.Status == StatusFailed {
+			ui.Info(fmt.Sprintf("\nProvider%s can be %s, but please review the warnings above.\n", prettyProviderName, t.Migrated))
+		} else {
+			ui.Info(fmt.Sprintf("\nProvider%s can be %s, but Go version %s is recommended.\n", prettyProviderName, t.Migrated, t.GoVersionConstraint))
+		}
+	}
+
+	return nil
+}
+
+func (r *humanReporter) ReportModules(providerPath string, results []*CheckResult) error {
+	for i, result := range results {
+		if i > 0 {
+			r.ui.Output("")
+		}
+		r.ui.Output(fmt.Sprintf("Module %s in %s:", result.ProviderName, relativePath(providerPath, result.ProviderPath)))
+		err := r.Report(result)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatModuleDirectives(ui cli.Ui, directives []*ModuleDirectiveUse) {
+	for _, d := range directives {
+		ui.Warn(fmt.Sprintf(" * %s", d.Directive))
+		ui.Warn(fmt.Sprintf("   %s", d.Message))
+	}
+}
+
+func formatTransitiveDependencies(ui cli.Ui, modPath string, deps []*DependencyChain) {
+	if len(deps) == 0 {
+		return
+	}
+
+	ui.Warn(fmt.Sprintf("Dependencies which still depend on %s:", modPath))
+	for _, dep := range deps {
+		ui.Warn(fmt.Sprintf(" * %s@%s", dep.Module.Path, dep.Module.Version))
+		ui.Warn(fmt.Sprintf("   %s", dep))
+	}
+}
+
+func formatSDKGenerations(ui cli.Ui, packages []*PackageGenerations) {
+	for _, g := range UsedGenerations(packages) {
+		ui.Warn(fmt.Sprintf("%s used in:", g))
+		for _, pg := range packages {
+			for _, imp := range pg.Imports {
+				if imp.Generation == g {
+					ui.Warn(fmt.Sprintf(" * %s (%s)", imp.Position, imp.ImportPath))
+				}
+			}
+		}
+	}
+
+	for _, pg := range packages {
+		if !pg.Mixed() {
+			continue
+		}
+		names := make([]string, 0, len(pg.Generations))
+		for _, g := range pg.Generations {
+			names = append(names, g.String())
+		}
+		ui.Warn(fmt.Sprintf("Package %s mixes %s", pg.ImportPath, strings.Join(names, ", ")))
+		for _, file := range pg.MixedFiles {
+			ui.Warn(fmt.Sprintf(" * in file %s", file))
+		}
+	}
+}
+
+func formatRemovedPackages(ui cli.Ui, removedPackagesInUse []*RemovedPackageUse) {
+	if len(removedPackagesInUse) == 0 {
+		return
+	}
+
+	ui.Warn("Deprecated SDK packages in use:")
+	for _, pkg := range removedPackagesInUse {
+		ui.Warn(fmt.Sprintf(" * %s", pkg.ImportPath))
+
+		if rp := pkg.Rule; rp != nil && rp.Replacement != "" {
+			ui.Warn(fmt.Sprintf("   * %s, use %s instead", rp.Message, rp.Replacement))
+		}
+	}
+}
+
+func formatRemovedIdents(ui cli.Ui, removedIdentsInUse []*Offence) {
+	if len(removedIdentsInUse) == 0 {
+		return
+	}
+	ui.Warn("Deprecated SDK identifiers in use:")
+	for _, ident := range removedIdentsInUse {
+		d := ident.IdentDeprecation
+		ui.Warn(fmt.Sprintf(" * %s (%s)", d.Name(), d.ImportPath))
+
+		for _, pos := range ident.Positions {
+			ui.Warn(fmt.Sprintf("   * %s", pos))
+		}
+	}
+}
+
+func formatFixedIdents(ui cli.Ui, fixedIdents []*Offence) {
+	if len(fixedIdents) == 0 {
+		return
+	}
+	ui.Info("Deprecated SDK identifiers rewritten automatically:")
+	for _, ident := range fixedIdents {
+		d := ident.IdentDeprecation
+		ui.Info(fmt.Sprintf(" * %s (%s)", d.Name(), d.ImportPath))
+
+		for _, pos := range ident.Positions {
+			ui.Info(fmt.Sprintf("   * %s", pos))
+		}
+	}
+}
+
+type csvReporter struct {
+	ui cli.Ui
+}
+
+// NewCSVReporter returns a reporter printing a single CSV record with a
+// header.
+func NewCSVReporter(ui cli.Ui) Reporter {
+	return &csvReporter{ui}
+}
+
+const csvHeader = "go_version,go_version_satisfies_constraint,uses_go_modules,sdk_version,sdk_version_satisfies_constraint,does_not_use_removed_packages,all_constraints_satisfied"
+
+func (r *csvReporter) Report(result *CheckResult) error {
+	r.ui.Output(fmt.Sprintf("%s\n%s", csvHeader, csvRecord(result)))
+	return nil
+}
+
+// ReportModules prints a record per module, with the module path in an
+// additional first column.
+func (r *csvReporter) ReportModules(providerPath string, results []*CheckResult) error {
+	lines := []string{"module," + csvHeader}
+	for _, result := range results {
+		lines = append(lines, result.ProviderName+","+csvRecord(result))
+	}
+	r.ui.Output(strings.Join(lines, "\n"))
+	return nil
+}
+
+func csvRecord(result *CheckResult) string {
+	usesRemovedPackagesOrIdents := len(result.RemovedPackagesInUse) > 0 || len(result.Offences) > 0
+	from := result.versionCheck(result.target().From)
+	constraintsSatisfied := result.Go.Satisfied && result.GoModules && from.Satisfied && !usesRemovedPackagesOrIdents
+
+	return fmt.Sprintf("%s,%t,%t,%s,%t,%t,%t",
+		result.Go.Version, result.Go.Satisfied, result.GoModules, from.Version, from.Satisfied, !usesRemovedPackagesOrIdents, constraintsSatisfied)
+}
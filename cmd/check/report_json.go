@@ -0,0 +1,304 @@
+package check
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+// jsonReportFormatVersion is incremented whenever fields of the JSON
+// report are removed or change meaning. New fields may be added without
+// changing it.
+//
+// Version 2: go is the version of the provider's go binary rather than
+// the one the migrator was built with.
+//
+// Version 3: a check of several modules prints a jsonModulesReport.
+const jsonReportFormatVersion = 3
+
+// jsonReport is the document printed by check --format=json. See the
+// README for a description of the fields.
+type jsonReport struct {
+	FormatVersion int        `json:"formatVersion"`
+	ProviderPath  string     `json:"providerPath"`
+	ProviderName  string     `json:"providerName,omitempty"`
+	Verdict       Verdict    `json:"verdict"`
+	Target        jsonTarget `json:"target"`
+
+	Checks      []*jsonSubCheck   `json:"checks"`
+	Go          jsonVersionCheck  `json:"go"`
+	GoDirective jsonVersionCheck  `json:"goDirective"`
+	GoToolchain jsonVersionCheck  `json:"goToolchain"`
+	GoModules   bool              `json:"goModules"`
+	SDK         jsonVersionCheck  `json:"sdk"`
+	SDKv2       *jsonVersionCheck `json:"sdkV2,omitempty"`
+	Terraform   jsonVersionCheck  `json:"terraform"`
+
+	ModuleDirectives       []*jsonModuleDirective `json:"moduleDirectives"`
+	TransitiveDependencies []*jsonDependency      `json:"transitiveDependencies"`
+	SDKGenerations         []*jsonSDKGenerations  `json:"sdkGenerations,omitempty"`
+	RemovedPackagesInUse   []*jsonRemovedPackage  `json:"removedPackagesInUse"`
+	Offences               []*jsonOffence         `json:"offences"`
+	FixedOffences          []*jsonOffence         `json:"fixedOffences,omitempty"`
+}
+
+// jsonModulesReport is the document printed by check --format=json for
+// a repository with several provider modules.
+type jsonModulesReport struct {
+	FormatVersion int           `json:"formatVersion"`
+	ProviderPath  string        `json:"providerPath"`
+	Verdict       Verdict       `json:"verdict"`
+	Modules       []*jsonReport `json:"modules"`
+}
+
+type jsonTarget struct {
+	From SDKGeneration `json:"from"`
+	To   SDKGeneration `json:"to"`
+}
+
+type jsonSubCheck struct {
+	Name     string   `json:"name"`
+	Status   Status   `json:"status"`
+	Severity Severity `json:"severity"`
+	Details  string   `json:"details,omitempty"`
+}
+
+type jsonVersionCheck struct {
+	Version    string `json:"version"`
+	Constraint string `json:"constraint"`
+	Satisfied  bool   `json:"satisfied"`
+}
+
+type jsonModuleDirective struct {
+	Directive  string `json:"directive"`
+	Kind       string `json:"kind"`
+	Path       string `json:"path"`
+	Version    string `json:"version,omitempty"`
+	NewPath    string `json:"newPath,omitempty"`
+	NewVersion string `json:"newVersion,omitempty"`
+	Message    string `json:"message"`
+}
+
+type jsonDependency struct {
+	Module  string   `json:"module"`
+	Version string   `json:"version"`
+	Chain   []string `json:"chain"`
+}
+
+type jsonSDKGenerations struct {
+	ImportPath  string                  `json:"importPath"`
+	Generations []SDKGeneration         `json:"generations"`
+	Imports     []*jsonGenerationImport `json:"imports"`
+	MixedFiles  []string                `json:"mixedFiles,omitempty"`
+}
+
+type jsonGenerationImport struct {
+	Generation SDKGeneration `json:"generation"`
+	ImportPath string        `json:"importPath"`
+	Position   *jsonPosition `json:"position"`
+}
+
+type jsonRemovedPackage struct {
+	ImportPath  string `json:"importPath"`
+	Message     string `json:"message,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+type jsonOffence struct {
+	ImportPath  string          `json:"importPath"`
+	Identifier  string          `json:"identifier"`
+	Message     string          `json:"message"`
+	Replacement string          `json:"replacement,omitempty"`
+	Positions   []*jsonPosition `json:"positions"`
+}
+
+// jsonPosition is a position in a file, relative to the provider root.
+type jsonPosition struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+type jsonReporter struct {
+	ui cli.Ui
+}
+
+// NewJSONReporter returns a reporter printing the versioned JSON
+// document described in the README.
+func NewJSONReporter(ui cli.Ui) Reporter {
+	return &jsonReporter{ui}
+}
+
+func (r *jsonReporter) Report(result *CheckResult) error {
+	r.ui.Output(newJSONReport(result).String())
+	return nil
+}
+
+func (r *jsonReporter) ReportModules(providerPath string, results []*CheckResult) error {
+	report := &jsonModulesReport{
+		FormatVersion: jsonReportFormatVersion,
+		ProviderPath:  providerPath,
+		Verdict:       OverallVerdict(results),
+		Modules:       make([]*jsonReport, 0, len(results)),
+	}
+	for _, result := range results {
+		report.Modules = append(report.Modules, newJSONReport(result))
+	}
+
+	r.ui.Output(marshalReport(report))
+	return nil
+}
+
+func newJSONReport(result *CheckResult) *jsonReport {
+	t := result.target()
+	report := &jsonReport{
+		FormatVersion:          jsonReportFormatVersion,
+		ProviderPath:           result.ProviderPath,
+		ProviderName:           result.ProviderName,
+		Verdict:                result.Verdict,
+		Target:                 jsonTarget{t.From, t.To},
+		Checks:                 make([]*jsonSubCheck, 0, len(result.Checks)),
+		Go:                     jsonVersionCheck(result.Go),
+		GoDirective:            jsonVersionCheck(result.GoDirective),
+		GoToolchain:            jsonVersionCheck(result.GoToolchain),
+		GoModules:              result.GoModules,
+		SDK:                    jsonVersionCheck(result.SDK),
+		Terraform:              jsonVersionCheck(result.Terraform),
+		ModuleDirectives:       newJSONModuleDirectives(result.ModuleDirectives),
+		TransitiveDependencies: newJSONDependencies(result.TransitiveDependencies),
+		SDKGenerations:         newJSONSDKGenerations(result.ProviderPath, result.SDKGenerations),
+		RemovedPackagesInUse:   newJSONRemovedPackages(result.RemovedPackagesInUse),
+		Offences:               newJSONOffences(result.ProviderPath, result.Offences),
+		FixedOffences:          newJSONOffences(result.ProviderPath, result.FixedOffences),
+	}
+	if t.From == GenerationSDKv2 || t.To == GenerationSDKv2 {
+		sdkV2 := jsonVersionCheck(result.SDKv2)
+		report.SDKv2 = &sdkV2
+	}
+	for _, sc := range result.Checks {
+		report.Checks = append(report.Checks, &jsonSubCheck{sc.Name, sc.Status, sc.Severity, sc.Details})
+	}
+	return report
+}
+
+func newJSONModuleDirectives(directives []*ModuleDirectiveUse) []*jsonModuleDirective {
+	jsonDirectives := make([]*jsonModuleDirective, 0, len(directives))
+	for _, d := range directives {
+		jsonDirectives = append(jsonDirectives, &jsonModuleDirective{
+			Directive:  d.Directive.String(),
+			Kind:       d.Directive.Kind,
+			Path:       d.Directive.Old.Path,
+			Version:    d.Directive.Old.Version,
+			NewPath:    d.Directive.New.Path,
+			NewVersion: d.Directive.New.Version,
+			Message:    d.Message,
+		})
+	}
+	return jsonDirectives
+}
+
+func newJSONDependencies(deps []*DependencyChain) []*jsonDependency {
+	jsonDeps := make([]*jsonDependency, 0, len(deps))
+	for _, dep := range deps {
+		jsonDeps = append(jsonDeps, &jsonDependency{
+			Module:  dep.Module.Path,
+			Version: dep.Module.Version,
+			Chain:   dep.chainStrings(),
+		})
+	}
+	return jsonDeps
+}
+
+func newJSONSDKGenerations(providerPath string, packages []*PackageGenerations) []*jsonSDKGenerations {
+	var jsonPackages []*jsonSDKGenerations
+	for _, pg := range packages {
+		jp := &jsonSDKGenerations{
+			ImportPath:  pg.ImportPath,
+			Generations: pg.Generations,
+			Imports:     make([]*jsonGenerationImport, 0, len(pg.Imports)),
+		}
+		for _, imp := range pg.Imports {
+			jp.Imports = append(jp.Imports, &jsonGenerationImport{
+				Generation: imp.Generation,
+				ImportPath: imp.ImportPath,
+				Position: &jsonPosition{
+					File:   relativePath(providerPath, imp.Position.Filename),
+					Line:   imp.Position.Line,
+					Column: imp.Position.Column,
+				},
+			})
+		}
+		for _, file := range pg.MixedFiles {
+			jp.MixedFiles = append(jp.MixedFiles, relativePath(providerPath, file))
+		}
+		jsonPackages = append(jsonPackages, jp)
+	}
+	return jsonPackages
+}
+
+func newJSONRemovedPackages(removedPackagesInUse []*RemovedPackageUse) []*jsonRemovedPackage {
+	pkgs := make([]*jsonRemovedPackage, 0, len(removedPackagesInUse))
+	for _, use := range removedPackagesInUse {
+		pkg := &jsonRemovedPackage{ImportPath: use.ImportPath}
+		if rp := use.Rule; rp != nil {
+			pkg.Message = rp.Message
+			pkg.Replacement = rp.Replacement
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs
+}
+
+func newJSONOffences(providerPath string, offences []*Offence) []*jsonOffence {
+	result := make([]*jsonOffence, 0, len(offences))
+	for _, o := range offences {
+		d := o.IdentDeprecation
+		jo := &jsonOffence{
+			ImportPath:  d.ImportPath,
+			Identifier:  d.Name(),
+			Message:     d.Message,
+			Replacement: d.Replacement,
+			Positions:   make([]*jsonPosition, 0, len(o.Positions)),
+		}
+		for _, pos := range o.Positions {
+			jo.Positions = append(jo.Positions, &jsonPosition{
+				File:   relativePath(providerPath, pos.Filename),
+				Line:   pos.Line,
+				Column: pos.Column,
+			})
+		}
+		result = append(result, jo)
+	}
+	return result
+}
+
+// relativePath returns path relative to the provider root, using
+// forward slashes, or path itself if it is outside of the root.
+func relativePath(providerPath, path string) string {
+	rel, err := filepath.Rel(providerPath, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (r *jsonReport) String() string {
+	return marshalReport(r)
+}
+
+// marshalReport returns v as indented JSON, without escaping HTML
+// characters such as those in version constraints.
+func marshalReport(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		// all fields are plain data
+		panic(err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,220 @@
+package check
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/cli"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+
+	// sarifRootBaseID is the base of all artifact locations, the
+	// provider root
+	sarifRootBaseID = "PROVIDERROOT"
+)
+
+// sarifLog is the subset of a SARIF 2.1.0 log printed by
+// check --format=sarif.
+type sarifLog struct {
+	Schema  string      `json:"$schema"`
+	Version string      `json:"version"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                         `json:"tool"`
+	OriginalURIBaseIDs map[string]*sarifArtifactLocation `json:"originalUriBaseIds"`
+	Results            []*sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string       `json:"name"`
+	InformationURI string       `json:"informationUri"`
+	Rules          []*sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	Help             sarifMessage `json:"help"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string           `json:"ruleId"`
+	RuleIndex int              `json:"ruleIndex"`
+	Level     string           `json:"level"`
+	Message   sarifMessage     `json:"message"`
+	Locations []*sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+type sarifReporter struct {
+	ui cli.Ui
+}
+
+// NewSARIFReporter returns a reporter printing a SARIF 2.1.0 log with a
+// result for every import of a removed package and every reference to a
+// removed identifier.
+func NewSARIFReporter(ui cli.Ui) Reporter {
+	return &sarifReporter{ui}
+}
+
+func (r *sarifReporter) Report(result *CheckResult) error {
+	return r.ReportModules(result.ProviderPath, []*CheckResult{result})
+}
+
+// ReportModules prints a single log with the results of every module,
+// relative to providerPath.
+func (r *sarifReporter) ReportModules(providerPath string, results []*CheckResult) error {
+	sarif := newSARIFLog(providerPath)
+	for _, result := range results {
+		sarif.addRemovedPackages(providerPath, result.RemovedPackagesInUse)
+		sarif.addOffences(providerPath, result.Offences)
+	}
+
+	r.ui.Output(sarif.String())
+	return nil
+}
+
+func newSARIFLog(providerPath string) *sarifLog {
+	rootURI := "file://" + filepath.ToSlash(providerPath)
+	if !strings.HasSuffix(rootURI, "/") {
+		rootURI += "/"
+	}
+
+	return &sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []*sarifRun{
+			{
+				Tool: sarifTool{
+					Driver: sarifDriver{
+						Name:           "tf-sdk-migrator",
+						InformationURI: "https://github.com/hashicorp/tf-sdk-migrator",
+						Rules:          []*sarifRule{},
+					},
+				},
+				OriginalURIBaseIDs: map[string]*sarifArtifactLocation{
+					sarifRootBaseID: {URI: rootURI},
+				},
+				Results: []*sarifResult{},
+			},
+		},
+	}
+}
+
+// rule returns the index of the rule with the given ID, adding it if
+// necessary.
+func (l *sarifLog) rule(id, description, help string) int {
+	driver := &l.Runs[0].Tool.Driver
+	for i, r := range driver.Rules {
+		if r.ID == id {
+			return i
+		}
+	}
+	driver.Rules = append(driver.Rules, &sarifRule{
+		ID:               id,
+		ShortDescription: sarifMessage{description},
+		Help:             sarifMessage{help},
+	})
+	return len(driver.Rules) - 1
+}
+
+func (l *sarifLog) addResult(ruleIndex int, message string, file string, line, column int) {
+	run := l.Runs[0]
+	run.Results = append(run.Results, &sarifResult{
+		RuleID:    run.Tool.Driver.Rules[ruleIndex].ID,
+		RuleIndex: ruleIndex,
+		Level:     "error",
+		Message:   sarifMessage{message},
+		Locations: []*sarifLocation{
+			{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{
+						URI:       file,
+						URIBaseID: sarifRootBaseID,
+					},
+					Region: sarifRegion{
+						StartLine:   line,
+						StartColumn: column,
+					},
+				},
+			},
+		},
+	})
+}
+
+// addRemovedPackages adds a result for every import of a removed
+// package, relative to providerPath. Rule IDs are derived from the
+// matching removed_packages rule.
+func (l *sarifLog) addRemovedPackages(providerPath string, removedPackagesInUse []*RemovedPackageUse) {
+	for _, use := range removedPackagesInUse {
+		importPath, rp := use.ImportPath, use.Rule
+		if rp == nil {
+			continue
+		}
+		help := rp.Message
+		if rp.Replacement != "" {
+			help = fmt.Sprintf("%s, use %s instead", rp.Message, rp.Replacement)
+		}
+		ruleIndex := l.rule("removed-package/"+rp.Path, fmt.Sprintf("Removed SDK package %s", rp.Path), help)
+
+		for _, pos := range use.Positions {
+			l.addResult(ruleIndex, fmt.Sprintf("%s: %s", importPath, rp.Message),
+				relativePath(providerPath, pos.Filename), pos.Line, pos.Column)
+		}
+	}
+}
+
+// addOffences adds a result for every position of every offence. Rule
+// IDs are derived from the deprecated identifier.
+func (l *sarifLog) addOffences(providerPath string, offences []*Offence) {
+	for _, o := range offences {
+		d := o.IdentDeprecation
+		help := d.Message
+		if d.Replacement != "" {
+			help = fmt.Sprintf("%s\n\nReplacement: %s", d.Message, d.Replacement)
+		}
+		ruleIndex := l.rule(fmt.Sprintf("removed-identifier/%s.%s", d.ImportPath, d.Name()),
+			fmt.Sprintf("Removed SDK identifier %s.%s", d.ImportPath, d.Name()), help)
+
+		for _, pos := range o.Positions {
+			l.addResult(ruleIndex, fmt.Sprintf("%s: %s", d.Name(), d.Message),
+				relativePath(providerPath, pos.Filename), pos.Line, pos.Column)
+		}
+	}
+}
+
+func (l *sarifLog) String() string {
+	return marshalReport(l)
+}
@@ -0,0 +1,259 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+)
+
+// Verdict is the overall outcome of a check.
+type Verdict string
+
+const (
+	// VerdictReady means all requirements are met.
+	VerdictReady Verdict = "ready"
+
+	// VerdictReadyWithWarnings means all hard requirements are met,
+	// but some soft requirement, such as the Go version, is not.
+	VerdictReadyWithWarnings Verdict = "ready_with_warnings"
+
+	// VerdictNotReady means some hard requirement is not met.
+	VerdictNotReady Verdict = "not_ready"
+
+	// VerdictAlreadyMigrated means the provider already uses the SDK
+	// generation it is checked for.
+	VerdictAlreadyMigrated Verdict = "already_migrated"
+)
+
+// Status is the outcome of a single sub-check.
+type Status string
+
+const (
+	StatusPassed  Status = "passed"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+// Severity describes how a failed sub-check affects the verdict.
+type Severity string
+
+const (
+	// SeverityError is a hard requirement for migrating.
+	SeverityError Severity = "error"
+
+	// SeverityWarning is a soft requirement, which is recommended but
+	// does not prevent migrating.
+	SeverityWarning Severity = "warning"
+)
+
+// Names of the sub-checks, in the order they are run for TargetSDKv1.
+// For TargetSDKv2, the version of SDK v2 is checked first, then that of
+// SDK v1.
+const (
+	SubCheckGoVersion          = "go_version"
+	SubCheckGoDirective        = "go_directive"
+	SubCheckGoToolchain        = "go_toolchain"
+	SubCheckGoModules          = "go_modules"
+	SubCheckSDKVersion         = "sdk_version"
+	SubCheckSDKv2Version       = "sdk_v2_version"
+	SubCheckTerraformVersion   = "terraform_version"
+	SubCheckModuleDirectives   = "module_directives"
+	SubCheckTransitiveDeps     = "transitive_dependencies"
+	SubCheckSDKGenerations     = "sdk_generations"
+	SubCheckRemovedPackages    = "removed_packages"
+	SubCheckRemovedIdentifiers = "removed_identifiers"
+)
+
+// SubCheck is the result of a single requirement check.
+type SubCheck struct {
+	Name     string
+	Status   Status
+	Severity Severity
+
+	// Details is a human-readable description of the outcome.
+	Details string
+}
+
+// VersionCheck is the result of checking a version against a
+// constraint. Version is empty if it could not be determined.
+type VersionCheck struct {
+	Version    string
+	Constraint string
+	Satisfied  bool
+}
+
+// RemovedPackageUse is an import of a package which was removed, along
+// with the rule matching it and the positions of its import specs.
+type RemovedPackageUse struct {
+	ImportPath string
+	Rule       *RemovedPackage
+	Positions  []token.Position
+}
+
+// CheckResult is the structured result of checking a provider.
+type CheckResult struct {
+	ProviderPath string
+	ProviderName string
+	Verdict      Verdict
+
+	// Target is the migration the provider was checked for.
+	Target *Target
+
+	// Checks holds every sub-check in the order they were run. Checks
+	// after one which ends the check early are skipped.
+	Checks []*SubCheck
+
+	// Go is the version of the go binary, GoDirective and GoToolchain
+	// the go and toolchain directives in go.mod
+	Go          VersionCheck
+	GoDirective VersionCheck
+	GoToolchain VersionCheck
+	GoModules   bool
+	SDK         VersionCheck
+	SDKv2       VersionCheck
+	Terraform   VersionCheck
+
+	// ModuleDirectives holds the replace and exclude directives in
+	// go.mod which need attention, see CheckModuleDirectives.
+	ModuleDirectives []*ModuleDirectiveUse
+
+	// TransitiveDependencies holds the dependencies which still
+	// require Terraform, see CheckTransitiveDependencies.
+	TransitiveDependencies []*DependencyChain
+
+	// SDKGenerations holds, if the provider mixes SDK generations, the
+	// imports of SDK packages of every provider package which has some.
+	SDKGenerations []*PackageGenerations
+
+	RemovedPackagesInUse []*RemovedPackageUse
+	Offences             []*Offence
+
+	// FixedOffences holds the references which were fixed
+	// automatically, and no longer count against the verdict.
+	FixedOffences []*Offence
+
+	// Stats holds analysis statistics, if they were requested.
+	Stats *AnalysisStats
+}
+
+// target returns the migration the provider was checked for, which
+// defaults to TargetSDKv1.
+func (r *CheckResult) target() *Target {
+	if r.Target == nil {
+		return TargetSDKv1
+	}
+	return r.Target
+}
+
+// versionCheck returns the check of the version of the module of
+// generation g the provider depends on.
+func (r *CheckResult) versionCheck(g SDKGeneration) *VersionCheck {
+	switch g {
+	case GenerationTerraform:
+		return &r.Terraform
+	case GenerationSDKv2:
+		return &r.SDKv2
+	}
+	return &r.SDK
+}
+
+// SubCheck returns the sub-check with the given name, or nil.
+func (r *CheckResult) SubCheck(name string) *SubCheck {
+	for _, sc := range r.Checks {
+		if sc.Name == name {
+			return sc
+		}
+	}
+	return nil
+}
+
+func (r *CheckResult) addCheck(name string, severity Severity, passed bool, details string) {
+	status := StatusFailed
+	if passed {
+		status = StatusPassed
+	}
+	r.Checks = append(r.Checks, &SubCheck{
+		Name:     name,
+		Status:   status,
+		Severity: severity,
+		Details:  details,
+	})
+}
+
+func (r *CheckResult) addSkippedCheck(name string, severity Severity, details string) {
+	r.Checks = append(r.Checks, &SubCheck{
+		Name:     name,
+		Status:   StatusSkipped,
+		Severity: severity,
+		Details:  details,
+	})
+}
+
+// skipRemaining marks every sub-check which has not run as skipped.
+func (r *CheckResult) skipRemaining() {
+	for _, name := range r.target().subChecks() {
+		if r.SubCheck(name) == nil {
+			r.Checks = append(r.Checks, &SubCheck{
+				Name:     name,
+				Status:   StatusSkipped,
+				Severity: SeverityError,
+			})
+		}
+	}
+}
+
+// setVerdict derives the verdict from the sub-checks.
+func (r *CheckResult) setVerdict() {
+	r.Verdict = VerdictReady
+	for _, sc := range r.Checks {
+		if sc.Status != StatusFailed {
+			continue
+		}
+		if sc.Severity == SeverityError {
+			r.Verdict = VerdictNotReady
+			return
+		}
+		r.Verdict = VerdictReadyWithWarnings
+	}
+}
+
+// OverallVerdict returns the verdict for several modules checked
+// together: not ready if any module is not ready, then ready with
+// warnings, and already migrated only if every module is.
+func OverallVerdict(results []*CheckResult) Verdict {
+	verdict := VerdictAlreadyMigrated
+	for _, r := range results {
+		switch {
+		case r.Verdict == VerdictNotReady:
+			return VerdictNotReady
+		case r.Verdict == VerdictReadyWithWarnings:
+			verdict = VerdictReadyWithWarnings
+		case r.Verdict == VerdictReady && verdict == VerdictAlreadyMigrated:
+			verdict = VerdictReady
+		}
+	}
+	return verdict
+}
+
+// Err returns nil if the provider can be migrated, an *AlreadyMigrated
+// error if it was migrated before, or an error describing why it
+// cannot be migrated.
+func (r *CheckResult) Err() error {
+	switch r.Verdict {
+	case VerdictReady, VerdictReadyWithWarnings:
+		return nil
+	case VerdictAlreadyMigrated:
+		return &AlreadyMigrated{r.versionCheck(r.target().To).Version}
+	}
+
+	t := r.target()
+	if sc := r.SubCheck(versionSubCheck(t.To)); sc != nil && sc.Status == StatusFailed {
+		return errors.New(sc.Details)
+	}
+	if r.versionCheck(t.From).Version == "" {
+		if sc := r.SubCheck(versionSubCheck(t.From)); sc != nil && sc.Status == StatusFailed {
+			return errors.New(sc.Details)
+		}
+	}
+	return fmt.Errorf("\nSome constraints not satisfied. Please resolve these before %s.", t.Migrating)
+}
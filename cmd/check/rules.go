@@ -0,0 +1,241 @@
+package check
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const rulesetFormatVersion = 1
+
+// Ruleset describes how SDK packages and identifiers moved or were
+// removed between two SDK generations. Rulesets are read from versioned
+// JSON documents, so that provider-specific rules or rules for new SDK
+// releases can be added without rebuilding the tool.
+type Ruleset struct {
+	FormatVersion      int                  `json:"format_version"`
+	Description        string               `json:"description,omitempty"`
+	PackageMoves       []*PackageMove       `json:"package_moves,omitempty"`
+	RemovedPackages    []*RemovedPackage    `json:"removed_packages,omitempty"`
+	RemovedIdentifiers []*RemovedIdentifier `json:"removed_identifiers,omitempty"`
+
+	deprecations []*identDeprecation
+}
+
+// PackageMove rewrites imports of From, and of packages below it, to To.
+type PackageMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RemovedPackage matches imports which are no longer available. Path is
+// either an import path or, ending in "/...", every package below it,
+// of which the packages listed in Except are still available. Unlike Go
+// package patterns, "/..." does not match the package at the root of
+// the tree itself.
+type RemovedPackage struct {
+	Path        string   `json:"path"`
+	Except      []string `json:"except,omitempty"`
+	Message     string   `json:"message,omitempty"`
+	Replacement string   `json:"replacement,omitempty"`
+}
+
+// RemovedIdentifier matches references to a package-level identifier
+// or, if Type is set, to a method or struct field of the named type Type.
+// Fix optionally names one of the built-in fixes to apply to it.
+type RemovedIdentifier struct {
+	ImportPath  string `json:"import_path"`
+	Type        string `json:"type,omitempty"`
+	Name        string `json:"name"`
+	Message     string `json:"message"`
+	Replacement string `json:"replacement,omitempty"`
+	Fix         string `json:"fix,omitempty"`
+}
+
+// fixes holds the built-in fixes rulesets can refer to by name.
+var fixes = map[string]fixFunc{
+	"new-resource-config-raw":         fixNewResourceConfig,
+	"cleanhttp-default-pooled-client": fixHTTPClientNew,
+}
+
+func (rp *RemovedPackage) matches(importPath string) bool {
+	if prefix := strings.TrimSuffix(rp.Path, "/..."); prefix != rp.Path {
+		if !strings.HasPrefix(importPath, prefix+"/") {
+			return false
+		}
+	} else if importPath != rp.Path {
+		return false
+	}
+
+	for _, e := range rp.Except {
+		if e == importPath {
+			return false
+		}
+	}
+	return true
+}
+
+// RemovedPackage returns the first rule matching importPath, or nil if
+// the package is still available.
+func (rs *Ruleset) RemovedPackage(importPath string) *RemovedPackage {
+	for _, rp := range rs.RemovedPackages {
+		if rp.matches(importPath) {
+			return rp
+		}
+	}
+	return nil
+}
+
+// deprecationFor returns the deprecation matching the package-level
+// object obj, if any.
+func (rs *Ruleset) deprecationFor(obj types.Object) *identDeprecation {
+	if obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		return nil
+	}
+	return rs.deprecation(obj.Pkg().Path(), obj.Name())
+}
+
+// deprecation returns the first deprecation of the package-level
+// identifier name of the package at importPath, which takes precedence
+// over any later one, if any.
+func (rs *Ruleset) deprecation(importPath, name string) *identDeprecation {
+	for _, d := range rs.deprecations {
+		if d.TypeName == "" && importPath == d.ImportPath && name == d.Identifier.Name {
+			return d
+		}
+	}
+	return nil
+}
+
+// ImportRewrites returns the package moves as a map from old to new
+// import path prefix. Of several moves of the same path, the first one
+// takes precedence, like the other rules.
+func (rs *Ruleset) ImportRewrites() map[string]string {
+	rewrites := make(map[string]string, len(rs.PackageMoves))
+	for _, pm := range rs.PackageMoves {
+		if _, ok := rewrites[pm.From]; !ok {
+			rewrites[pm.From] = pm.To
+		}
+	}
+	return rewrites
+}
+
+// Merge adds the rules of other to rs. Rules from other take precedence.
+func (rs *Ruleset) Merge(other *Ruleset) {
+	rs.PackageMoves = append(other.PackageMoves, rs.PackageMoves...)
+	rs.RemovedPackages = append(other.RemovedPackages, rs.RemovedPackages...)
+	rs.RemovedIdentifiers = append(other.RemovedIdentifiers, rs.RemovedIdentifiers...)
+	rs.deprecations = append(other.deprecations, rs.deprecations...)
+}
+
+func ParseRuleset(filename string, content []byte) (*Ruleset, error) {
+	rs := &Ruleset{}
+	err := json.Unmarshal(content, rs)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse ruleset %s: %s", filename, err)
+	}
+
+	if rs.FormatVersion != rulesetFormatVersion {
+		return nil, fmt.Errorf("%s: unsupported ruleset format_version %d (expected %d)",
+			filename, rs.FormatVersion, rulesetFormatVersion)
+	}
+
+	for i, pm := range rs.PackageMoves {
+		if pm.From == "" || pm.To == "" {
+			return nil, fmt.Errorf("%s: package_moves[%d]: from and to are required", filename, i)
+		}
+	}
+	for i, rp := range rs.RemovedPackages {
+		if rp.Path == "" {
+			return nil, fmt.Errorf("%s: removed_packages[%d]: path is required", filename, i)
+		}
+	}
+	for i, ri := range rs.RemovedIdentifiers {
+		if ri.ImportPath == "" || ri.Name == "" {
+			return nil, fmt.Errorf("%s: removed_identifiers[%d]: import_path and name are required", filename, i)
+		}
+		d := &identDeprecation{
+			ImportPath:  ri.ImportPath,
+			Identifier:  ast.NewIdent(ri.Name),
+			TypeName:    ri.Type,
+			Message:     ri.Message,
+			Replacement: ri.Replacement,
+		}
+		if ri.Fix != "" {
+			fix, ok := fixes[ri.Fix]
+			if !ok {
+				return nil, fmt.Errorf("%s: removed_identifiers[%d]: unknown fix %q", filename, i, ri.Fix)
+			}
+			d.Fix = fix
+		}
+		rs.deprecations = append(rs.deprecations, d)
+	}
+
+	return rs, nil
+}
+
+// DefaultRuleset returns the built-in rules for migrating from
+// github.com/hashicorp/terraform to the SDK.
+func DefaultRuleset() *Ruleset {
+	return TargetSDKv1.DefaultRuleset()
+}
+
+// DefaultRuleset returns the built-in rules for the migration t.
+func (t *Target) DefaultRuleset() *Ruleset {
+	rs, err := ParseRuleset("default ruleset", []byte(t.defaultRuleset))
+	if err != nil {
+		panic(err)
+	}
+	return rs
+}
+
+// LoadRuleset returns the built-in rules merged with the rules read from
+// paths. A path may be a ruleset file or a directory of *.json files.
+func LoadRuleset(paths []string) (*Ruleset, error) {
+	return TargetSDKv1.LoadRuleset(paths)
+}
+
+// LoadRuleset is like the LoadRuleset function, but starts from the
+// built-in rules for the migration t.
+func (t *Target) LoadRuleset(paths []string) (*Ruleset, error) {
+	rs := t.DefaultRuleset()
+
+	for _, path := range paths {
+		files := []string{path}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			files, err = filepath.Glob(filepath.Join(path, "*.json"))
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(files)
+		}
+
+		for _, file := range files {
+			if filepath.Ext(file) == ".hcl" {
+				return nil, fmt.Errorf("%s: rulesets must be written in JSON", file)
+			}
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			other, err := ParseRuleset(file, content)
+			if err != nil {
+				return nil, err
+			}
+			rs.Merge(other)
+		}
+	}
+
+	return rs, nil
+}
@@ -0,0 +1,10 @@
+package check
+
+import _ "embed"
+
+// defaultRuleset is the built-in ruleset for migrating a provider from
+// github.com/hashicorp/terraform to github.com/hashicorp/terraform-plugin-sdk.
+// Rulesets passed via --rules use the same format.
+//
+//go:embed rules/sdk_v1.json
+var defaultRuleset string
@@ -0,0 +1,146 @@
+package check
+
+import (
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestRemovedPackageMatches(t *testing.T) {
+	rp := &RemovedPackage{
+		Path:   "github.com/hashicorp/terraform/...",
+		Except: []string{"github.com/hashicorp/terraform/helper/schema"},
+	}
+
+	cases := []struct {
+		importPath string
+		want       bool
+	}{
+		{"github.com/hashicorp/terraform", false},
+		{"github.com/hashicorp/terraform/config", true},
+		{"github.com/hashicorp/terraform/helper/resource", true},
+		{"github.com/hashicorp/terraform/helper/schema", false},
+		{"github.com/hashicorp/terraform-plugin-sdk/helper/schema", false},
+		{"github.com/hashicorp/terraformer", false},
+	}
+	for _, tc := range cases {
+		if got := rp.matches(tc.importPath); got != tc.want {
+			t.Errorf("matches(%q) = %t, expected %t", tc.importPath, got, tc.want)
+		}
+	}
+
+	exact := &RemovedPackage{Path: "github.com/hashicorp/terraform/httpclient"}
+	if !exact.matches("github.com/hashicorp/terraform/httpclient") {
+		t.Errorf("an exact path does not match itself")
+	}
+	if exact.matches("github.com/hashicorp/terraform/httpclient/sub") {
+		t.Errorf("an exact path matches the packages below it")
+	}
+}
+
+func TestDefaultRulesetRemovedPackage(t *testing.T) {
+	rs := DefaultRuleset()
+
+	// the root package of Terraform was never flagged, as it is not an
+	// SDK package providers import
+	if rp := rs.RemovedPackage("github.com/hashicorp/terraform"); rp != nil {
+		t.Errorf("github.com/hashicorp/terraform is flagged by %q", rp.Path)
+	}
+	if rp := rs.RemovedPackage("github.com/hashicorp/terraform/config"); rp == nil {
+		t.Errorf("github.com/hashicorp/terraform/config is not flagged")
+	}
+	if rp := rs.RemovedPackage("github.com/hashicorp/terraform/helper/schema"); rp != nil {
+		t.Errorf("github.com/hashicorp/terraform/helper/schema is flagged by %q", rp.Path)
+	}
+}
+
+func TestParseRulesetErrors(t *testing.T) {
+	cases := map[string]string{
+		"invalid JSON":                 `{`,
+		"unsupported version":          `{"format_version": 2}`,
+		"package move without to":      `{"format_version": 1, "package_moves": [{"from": "a"}]}`,
+		"removed package without path": `{"format_version": 1, "removed_packages": [{"message": "m"}]}`,
+		"identifier without name":      `{"format_version": 1, "removed_identifiers": [{"import_path": "a"}]}`,
+		"unknown fix":                  `{"format_version": 1, "removed_identifiers": [{"import_path": "a", "name": "B", "fix": "nope"}]}`,
+	}
+	for name, content := range cases {
+		if _, err := ParseRuleset(name, []byte(content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadRulesetHCL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tf-sdk-migrator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "rules.hcl")
+	if err := ioutil.WriteFile(path, []byte("format_version = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRuleset([]string{path}); err == nil {
+		t.Errorf("expected an error for an HCL ruleset")
+	}
+}
+
+func TestRulesetPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tf-sdk-migrator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rulesPath := filepath.Join(dir, "rules.json")
+	rules := `{
+  "format_version": 1,
+  "package_moves": [
+    {"from": "github.com/hashicorp/terraform", "to": "example.com/fork/terraform-plugin-sdk"}
+  ],
+  "removed_identifiers": [
+    {"import_path": "github.com/hashicorp/terraform/terraform", "name": "NewResourceConfig", "message": "overridden"}
+  ]
+}`
+	if err := ioutil.WriteFile(rulesPath, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := LoadRuleset([]string{rulesPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if to := rs.ImportRewrites()["github.com/hashicorp/terraform"]; to != "example.com/fork/terraform-plugin-sdk" {
+		t.Errorf("github.com/hashicorp/terraform is rewritten to %s", to)
+	}
+
+	// references found without type information are only reported for
+	// the overriding rule
+	srcPath := filepath.Join(dir, "provider.go")
+	src := `package provider
+
+import "github.com/hashicorp/terraform/terraform"
+
+var c = terraform.NewResourceConfig(nil)
+`
+	if err := ioutil.WriteFile(srcPath, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unit := &packages.Package{ID: "example.com/provider", PkgPath: "example.com/provider", GoFiles: []string{srcPath}}
+	refs, err := findUnitReferences(util.NewChangeset(), token.NewFileSet(), unit, nil, nil, rs, &AnalysisStats{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].deprecation.Message != "overridden" {
+		for _, ref := range refs {
+			t.Logf("%s: %s", ref.fset.Position(ref.ident.Pos()), ref.deprecation.Message)
+		}
+		t.Errorf("expected a single reference for the overriding rule, got %d", len(refs))
+	}
+}
@@ -0,0 +1,13 @@
+package check
+
+import _ "embed"
+
+// v2Ruleset is the built-in ruleset for upgrading a provider from
+// github.com/hashicorp/terraform-plugin-sdk to
+// github.com/hashicorp/terraform-plugin-sdk/v2. It lists the packages and
+// identifiers of the last v1 release which providers may use and which
+// were removed in v2, leaving out the internals of Terraform which SDK
+// v1 still exported.
+//
+//go:embed rules/sdk_v2.json
+var v2Ruleset string
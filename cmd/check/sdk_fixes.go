@@ -0,0 +1,414 @@
+package check
+
+import (
+	"go/ast"
+	"go/token"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+)
+
+// fixFunc rewrites a single reference to a deprecated identifier in
+// place. It returns false if the reference needs manual attention.
+type fixFunc func(fc *fixContext) bool
+
+type fixContext struct {
+	fset *token.FileSet
+	file *ast.File
+
+	// ref is the qualified reference to the deprecated identifier and
+	// stack holds its ancestors, innermost last.
+	ref   *ast.SelectorExpr
+	stack []ast.Node
+}
+
+// call returns the call expression ref is the function of, if any.
+func (fc *fixContext) call() *ast.CallExpr {
+	if len(fc.stack) == 0 {
+		return nil
+	}
+	call, ok := fc.stack[len(fc.stack)-1].(*ast.CallExpr)
+	if !ok || call.Fun != fc.ref {
+		return nil
+	}
+	return call
+}
+
+// fixNewResourceConfig rewrites terraform.NewResourceConfig(nil) and
+// terraform.NewResourceConfig(c), where c was returned by
+// config.NewRawConfig(raw) for a variable raw, to
+// terraform.NewResourceConfigRaw. The config.NewRawConfig call is
+// removed along with the check of its error, so c must not be used
+// anywhere else.
+func fixNewResourceConfig(fc *fixContext) bool {
+	call := fc.call()
+	if call == nil || len(call.Args) != 1 {
+		return false
+	}
+
+	arg, ok := call.Args[0].(*ast.Ident)
+	if !ok {
+		return false
+	}
+	if arg.Name == "nil" && arg.Obj == nil {
+		fc.ref.Sel = ast.NewIdent("NewResourceConfigRaw")
+		return true
+	}
+
+	assign, raw := rawConfigSource(fc.file, arg)
+	if assign == nil {
+		return false
+	}
+	rawIdent, ok := raw.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	block, removed := rawConfigStmts(fc.file, assign, arg)
+	if block == nil {
+		return false
+	}
+
+	fc.ref.Sel = ast.NewIdent("NewResourceConfigRaw")
+	call.Args[0] = ast.NewIdent(rawIdent.Name)
+	removeStmts(fc.fset, block, removed)
+	util.DeleteUnusedImport(fc.fset, fc.file, configPackagePath)
+	return true
+}
+
+const configPackagePath = "github.com/hashicorp/terraform/config"
+
+// rawConfigSource returns the statement declaring ident as the result of
+// config.NewRawConfig(raw), and raw.
+func rawConfigSource(f *ast.File, ident *ast.Ident) (*ast.AssignStmt, ast.Expr) {
+	if ident.Obj == nil {
+		return nil, nil
+	}
+	assign, ok := ident.Obj.Decl.(*ast.AssignStmt)
+	if !ok || assign.Tok != token.DEFINE || len(assign.Rhs) != 1 {
+		return nil, nil
+	}
+	call, ok := assign.Rhs[0].(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return nil, nil
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "NewRawConfig" {
+		return nil, nil
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok || pkg.Obj != nil || pkg.Name != util.ImportName(f, configPackagePath) {
+		return nil, nil
+	}
+	return assign, call.Args[0]
+}
+
+// rawConfigStmts returns the statements which can be removed once the
+// only use of c, the argument of terraform.NewResourceConfig, is
+// replaced: assign, which declares c as the result of
+// config.NewRawConfig, and the `if err != nil` check following it, if
+// any, along with the block holding them. It returns a nil block if c,
+// or the error declared by assign, is used anywhere else.
+func rawConfigStmts(f *ast.File, assign *ast.AssignStmt, c *ast.Ident) (*[]ast.Stmt, []ast.Stmt) {
+	if len(assign.Lhs) > 2 {
+		return nil, nil
+	}
+	var errIdent *ast.Ident
+	if len(assign.Lhs) == 2 {
+		errIdent, _ = assign.Lhs[1].(*ast.Ident)
+		if errIdent == nil {
+			return nil, nil
+		}
+		if errIdent.Name == "_" {
+			errIdent = nil
+		}
+	}
+
+	block := enclosingStmtList(f, assign)
+	if block == nil {
+		return nil, nil
+	}
+	removed := []ast.Stmt{assign}
+	var check *ast.IfStmt
+	if errIdent != nil {
+		for i, stmt := range *block {
+			if stmt == assign && i+1 < len(*block) {
+				check, _ = (*block)[i+1].(*ast.IfStmt)
+			}
+		}
+		if check != nil && !isErrCheck(check, errIdent) {
+			check = nil
+		}
+		if check != nil {
+			removed = append(removed, check)
+		}
+	}
+
+	// the uses of c and err, other than in the removed statements and
+	// the replaced argument, which must not exist
+	inRemoved := func(n ast.Node) bool {
+		for _, stmt := range removed {
+			if n.Pos() >= stmt.Pos() && n.End() <= stmt.End() {
+				return true
+			}
+		}
+		return false
+	}
+	used := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok || ident.Obj == nil || ident == c || inRemoved(ident) {
+			return !used
+		}
+		if ident.Obj == c.Obj {
+			used = true
+		}
+		// err is only removed if it was declared by assign
+		if errIdent != nil && ident.Obj == errIdent.Obj && (errIdent.Obj.Decl == assign || check == nil) {
+			used = true
+		}
+		return !used
+	})
+	if used {
+		return nil, nil
+	}
+	return block, removed
+}
+
+// isErrCheck reports whether stmt is `if err != nil { ... }` without an
+// init statement or else branch.
+func isErrCheck(stmt *ast.IfStmt, err *ast.Ident) bool {
+	if stmt.Init != nil || stmt.Else != nil {
+		return false
+	}
+	cond, ok := stmt.Cond.(*ast.BinaryExpr)
+	if !ok || cond.Op != token.NEQ {
+		return false
+	}
+	x, ok := cond.X.(*ast.Ident)
+	if !ok || x.Obj != err.Obj {
+		return false
+	}
+	y, ok := cond.Y.(*ast.Ident)
+	return ok && y.Name == "nil" && y.Obj == nil
+}
+
+// enclosingStmtList returns the statement list of f holding stmt.
+func enclosingStmtList(f *ast.File, stmt ast.Stmt) *[]ast.Stmt {
+	var list *[]ast.Stmt
+	ast.Inspect(f, func(n ast.Node) bool {
+		if list != nil {
+			return false
+		}
+		var stmts *[]ast.Stmt
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			stmts = &n.List
+		case *ast.CaseClause:
+			stmts = &n.Body
+		case *ast.CommClause:
+			stmts = &n.Body
+		default:
+			return true
+		}
+		for _, s := range *stmts {
+			if s == stmt {
+				list = stmts
+				return false
+			}
+		}
+		return true
+	})
+	return list
+}
+
+// removeStmts removes stmts from list, joining their lines with the
+// following ones so that they do not leave empty lines behind.
+func removeStmts(fset *token.FileSet, list *[]ast.Stmt, stmts []ast.Stmt) {
+	removed := make(map[ast.Stmt]bool)
+	for i := len(stmts) - 1; i >= 0; i-- {
+		stmt := stmts[i]
+		removed[stmt] = true
+		tokFile := fset.File(stmt.Pos())
+		for line := tokFile.Line(stmt.End()); line >= tokFile.Line(stmt.Pos()); line-- {
+			if line < tokFile.LineCount() {
+				tokFile.MergeLine(line)
+			}
+		}
+	}
+
+	kept := (*list)[:0]
+	for _, stmt := range *list {
+		if !removed[stmt] {
+			kept = append(kept, stmt)
+		}
+	}
+	*list = kept
+}
+
+// fixHTTPClientNew rewrites httpclient.New() to
+// cleanhttp.DefaultPooledClient().
+func fixHTTPClientNew(fc *fixContext) bool {
+	call := fc.call()
+	if call == nil || len(call.Args) != 0 {
+		return false
+	}
+
+	name := util.AddImport(fc.fset, fc.file, "github.com/hashicorp/go-cleanhttp")
+	call.Fun = &ast.SelectorExpr{
+		X:   ast.NewIdent(name),
+		Sel: ast.NewIdent("DefaultPooledClient"),
+	}
+	util.DeleteUnusedImport(fc.fset, fc.file, "github.com/hashicorp/terraform/httpclient")
+	return true
+}
+
+// FixSDKPackageRefs applies the available fix for every reference to a
+// deprecated identifier and stages the rewritten files in the changeset
+// details were loaded through. It returns the references which were
+// fixed and those which need manual attention.
+func FixSDKPackageRefs(details *ProviderImportDetails, rules *Ruleset, opts *AnalysisOptions) (fixed []*Offence, unfixed []*Offence, err error) {
+	fset, cs := details.fset, details.cs
+	refs, err := findReferences(details, rules, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refsByFile := make(map[*parsedFile]map[*ast.Ident]*reference)
+	files := []*parsedFile{}
+	for _, ref := range refs {
+		if _, ok := refsByFile[ref.file]; !ok {
+			refsByFile[ref.file] = make(map[*ast.Ident]*reference)
+			files = append(files, ref.file)
+		}
+		refsByFile[ref.file][ref.ident] = ref
+	}
+
+	fixedPositions := make(map[*identDeprecation][]*token.Position)
+	unfixedPositions := make(map[*identDeprecation][]*token.Position)
+
+	for _, file := range files {
+		fileRefs := refsByFile[file]
+
+		// collect the fix contexts first, fixes may modify the AST
+		contexts := make(map[*ast.Ident]*fixContext)
+		stack := []ast.Node{}
+		ast.Inspect(file.ast, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if _, ok := fileRefs[sel.Sel]; ok {
+					contexts[sel.Sel] = &fixContext{
+						fset:  fset,
+						file:  file.ast,
+						ref:   sel,
+						stack: append([]ast.Node(nil), stack...),
+					}
+				}
+			}
+			stack = append(stack, n)
+			return true
+		})
+
+		// fixes may remove lines, so positions are taken first
+		positions := make(map[*reference]token.Position)
+		for _, ref := range refs {
+			if ref.file == file {
+				positions[ref] = fset.Position(ref.ident.Pos())
+			}
+		}
+
+		modified := false
+		fixedRefs := make(map[*reference]bool)
+		for _, ref := range refs {
+			if ref.file != file || ref.deprecation.Fix == nil {
+				continue
+			}
+			fc, ok := contexts[ref.ident]
+			if ok && ref.deprecation.Fix(fc) {
+				fixedRefs[ref] = true
+				modified = true
+			}
+		}
+
+		// fixes may remove other references, e.g. the config.NewRawConfig
+		// call whose result was passed to terraform.NewResourceConfig
+		remaining := make(map[*ast.Ident]bool)
+		if modified {
+			ast.Inspect(file.ast, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok {
+					remaining[ident] = true
+				}
+				return true
+			})
+		}
+
+		for _, ref := range refs {
+			if ref.file != file {
+				continue
+			}
+			d := ref.deprecation
+			position := positions[ref]
+			if fixedRefs[ref] || modified && !remaining[ref.ident] {
+				fixedPositions[d] = append(fixedPositions[d], &position)
+			} else {
+				unfixedPositions[d] = append(unfixedPositions[d], &position)
+			}
+		}
+
+		if modified {
+			content, err := util.FormatFile(fset, file.ast)
+			if err != nil {
+				return nil, nil, err
+			}
+			err = cs.WriteFile(file.path, content)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	fixed = make([]*Offence, 0, 0)
+	unfixed = make([]*Offence, 0, 0)
+	for _, d := range rules.deprecations {
+		if positions := fixedPositions[d]; len(positions) > 0 {
+			fixed = append(fixed, &Offence{IdentDeprecation: d, Positions: positions})
+		}
+		if positions := unfixedPositions[d]; len(positions) > 0 {
+			unfixed = append(unfixed, &Offence{IdentDeprecation: d, Positions: positions})
+		}
+	}
+
+	return fixed, unfixed, nil
+}
+
+// findQualifiedRefs returns every pkgName.identName selector in f where
+// pkgName refers to the imported package rather than a local object.
+func findQualifiedRefs(fset *token.FileSet, f *ast.File, pkgName, identName string) []*fixContext {
+	refs := []*fixContext{}
+	stack := []ast.Node{}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			x, ok := sel.X.(*ast.Ident)
+			if ok && x.Obj == nil && x.Name == pkgName && sel.Sel.Name == identName {
+				refs = append(refs, &fixContext{
+					fset:  fset,
+					file:  f,
+					ref:   sel,
+					stack: append([]ast.Node(nil), stack...),
+				})
+			}
+		}
+
+		stack = append(stack, n)
+		return true
+	})
+
+	return refs
+}
@@ -0,0 +1,209 @@
+package check
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SDKGeneration is a generation of the packages providers are built
+// with. Types of different generations are incompatible, so a provider
+// must only use one.
+type SDKGeneration string
+
+const (
+	// GenerationTerraform is the SDK included in Terraform itself.
+	GenerationTerraform SDKGeneration = "terraform"
+
+	GenerationSDKv1 SDKGeneration = "sdk_v1"
+	GenerationSDKv2 SDKGeneration = "sdk_v2"
+)
+
+var generationOrder = map[SDKGeneration]int{
+	GenerationTerraform: 0,
+	GenerationSDKv1:     1,
+	GenerationSDKv2:     2,
+}
+
+// String describes g by its module path.
+func (g SDKGeneration) String() string {
+	switch g {
+	case GenerationSDKv1:
+		return sdkModPath + " (v1)"
+	case GenerationSDKv2:
+		return sdkV2ModPath + " (v2)"
+	}
+	return g.ModulePath()
+}
+
+// ModulePath returns the path of the module of generation g.
+func (g SDKGeneration) ModulePath() string {
+	switch g {
+	case GenerationTerraform:
+		return tfModPath
+	case GenerationSDKv1:
+		return sdkModPath
+	case GenerationSDKv2:
+		return sdkV2ModPath
+	}
+	return string(g)
+}
+
+// displayName names the module of generation g in messages.
+func (g SDKGeneration) displayName() string {
+	switch g {
+	case GenerationTerraform:
+		return "Terraform"
+	case GenerationSDKv2:
+		return "SDK v2"
+	}
+	return "SDK"
+}
+
+// ImportGeneration returns the SDK generation importPath belongs to, or
+// an empty string if it is not part of any.
+func ImportGeneration(importPath string) SDKGeneration {
+	switch {
+	case importPath == sdkV2ModPath || strings.HasPrefix(importPath, sdkV2ModPath+"/"):
+		return GenerationSDKv2
+	case importPath == sdkModPath || strings.HasPrefix(importPath, sdkModPath+"/"):
+		return GenerationSDKv1
+	case importPath == tfModPath || strings.HasPrefix(importPath, tfModPath+"/"):
+		return GenerationTerraform
+	}
+	return ""
+}
+
+// GenerationImport is an import of a package of an SDK generation.
+type GenerationImport struct {
+	Generation SDKGeneration
+	ImportPath string
+	Position   token.Position
+}
+
+// PackageGenerations holds the imports of SDK packages in a provider
+// package.
+type PackageGenerations struct {
+	ImportPath string
+
+	// Generations holds the generations imported by the package, oldest
+	// first.
+	Generations []SDKGeneration
+
+	// Imports holds every import of an SDK package, in file order.
+	Imports []*GenerationImport
+
+	// MixedFiles holds the files which import packages of several
+	// generations.
+	MixedFiles []string
+}
+
+// Mixed reports whether the package imports several SDK generations.
+func (pg *PackageGenerations) Mixed() bool {
+	return len(pg.Generations) > 1
+}
+
+// CheckSDKGenerations returns the imports of SDK packages, of any
+// generation, of every provider package which has some, sorted by
+// import path. Imports in external tests count towards the package
+// they test.
+func CheckSDKGenerations(details *ProviderImportDetails) []*PackageGenerations {
+	var packages []*PackageGenerations
+	byImportPath := make(map[string]*PackageGenerations)
+
+	for _, unit := range details.units {
+		importPath := strings.TrimSuffix(unit.PkgPath, "_test")
+		pg, ok := byImportPath[importPath]
+		if !ok {
+			pg = &PackageGenerations{ImportPath: importPath}
+			byImportPath[importPath] = pg
+		}
+
+		for _, f := range unit.Syntax {
+			fileGenerations := make(map[SDKGeneration]bool)
+			for _, spec := range f.Imports {
+				importPath, err := strconv.Unquote(spec.Path.Value)
+				if err != nil {
+					continue
+				}
+				g := ImportGeneration(importPath)
+				if g == "" {
+					continue
+				}
+				pg.Imports = append(pg.Imports, &GenerationImport{
+					Generation: g,
+					ImportPath: importPath,
+					Position:   details.fset.Position(spec.Path.Pos()),
+				})
+				fileGenerations[g] = true
+				if len(pg.Imports) == 1 {
+					packages = append(packages, pg)
+				}
+			}
+			if len(fileGenerations) > 1 {
+				pg.MixedFiles = append(pg.MixedFiles, details.fset.File(f.Pos()).Name())
+			}
+		}
+	}
+
+	for _, pg := range packages {
+		seen := make(map[SDKGeneration]bool)
+		for _, imp := range pg.Imports {
+			if !seen[imp.Generation] {
+				seen[imp.Generation] = true
+				pg.Generations = append(pg.Generations, imp.Generation)
+			}
+		}
+		sortGenerations(pg.Generations)
+	}
+
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].ImportPath < packages[j].ImportPath
+	})
+	return packages
+}
+
+// addSDKGenerationsCheck adds the sub-check failing if the provider
+// packages in details import packages of several SDK generations.
+func addSDKGenerationsCheck(result *CheckResult, details *ProviderImportDetails) {
+	packages := CheckSDKGenerations(details)
+
+	generations := UsedGenerations(packages)
+	if len(generations) <= 1 {
+		result.addCheck(SubCheckSDKGenerations, SeverityError, true, "No mixed SDK generations: OK.")
+		return
+	}
+
+	result.SDKGenerations = packages
+	names := make([]string, 0, len(generations))
+	for _, g := range generations {
+		names = append(names, g.String())
+	}
+	result.addCheck(SubCheckSDKGenerations, SeverityError, false,
+		fmt.Sprintf("Provider mixes SDK generations, whose types are incompatible: %s.", strings.Join(names, ", ")))
+}
+
+// UsedGenerations returns the SDK generations imported by packages,
+// oldest first.
+func UsedGenerations(packages []*PackageGenerations) []SDKGeneration {
+	seen := make(map[SDKGeneration]bool)
+	var generations []SDKGeneration
+	for _, pg := range packages {
+		for _, g := range pg.Generations {
+			if !seen[g] {
+				seen[g] = true
+				generations = append(generations, g)
+			}
+		}
+	}
+	sortGenerations(generations)
+	return generations
+}
+
+func sortGenerations(generations []SDKGeneration) {
+	sort.Slice(generations, func(i, j int) bool {
+		return generationOrder[generations[i]] < generationOrder[generations[j]]
+	})
+}
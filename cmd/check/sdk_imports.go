@@ -1,38 +1,45 @@
 package check
 
 import (
-	"strings"
+	"go/token"
+	"sort"
+	"strconv"
 )
 
-var sdkPackages = map[string]bool{
-	"github.com/hashicorp/terraform/helper/acctest":        true,
-	"github.com/hashicorp/terraform/helper/customdiff":     true,
-	"github.com/hashicorp/terraform/helper/encryption":     true,
-	"github.com/hashicorp/terraform/helper/hashcode":       true,
-	"github.com/hashicorp/terraform/helper/logging":        true,
-	"github.com/hashicorp/terraform/helper/mutexkv":        true,
-	"github.com/hashicorp/terraform/helper/pathorcontents": true,
-	"github.com/hashicorp/terraform/helper/resource":       true,
-	"github.com/hashicorp/terraform/helper/schema":         true,
-	"github.com/hashicorp/terraform/helper/structure":      true,
-	"github.com/hashicorp/terraform/helper/validation":     true,
-	"github.com/hashicorp/terraform/httpclient":            true,
-	"github.com/hashicorp/terraform/plugin":                true,
-	"github.com/hashicorp/terraform/terraform":             true,
-}
-
-func CheckSDKPackageImports(details *ProviderImportDetails) ([]string, error) {
+// CheckSDKPackageImports returns the imported packages which are removed
+// according to rules.
+func CheckSDKPackageImports(details *ProviderImportDetails, rules *Ruleset) ([]string, error) {
 	removedPackagesInUse := []string{}
 
 	for importPath := range details.AllImportPathsHash {
-		if !strings.HasPrefix(importPath, "github.com/hashicorp/terraform/") {
-			continue
-		}
-
-		if isSDK := sdkPackages[importPath]; !isSDK {
+		if rules.RemovedPackage(importPath) != nil {
 			removedPackagesInUse = append(removedPackagesInUse, importPath)
 		}
 	}
+	sort.Strings(removedPackagesInUse)
 
 	return removedPackagesInUse, nil
 }
+
+// importPositions returns the positions of the import specs of
+// importPaths in the files of the provider packages, including tests.
+func (details *ProviderImportDetails) importPositions(importPaths []string) map[string][]token.Position {
+	wanted := make(map[string]bool, len(importPaths))
+	for _, p := range importPaths {
+		wanted[p] = true
+	}
+
+	positions := make(map[string][]token.Position)
+	for _, unit := range details.units {
+		for _, f := range unit.Syntax {
+			for _, spec := range f.Imports {
+				importPath, err := strconv.Unquote(spec.Path.Value)
+				if err != nil || !wanted[importPath] {
+					continue
+				}
+				positions[importPath] = append(positions[importPath], details.fset.Position(spec.Path.Pos()))
+			}
+		}
+	}
+	return positions
+}
@@ -1,15 +1,21 @@
 package check
 
 import (
+	"context"
 	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
-	"path"
+	"go/types"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/tf-sdk-migrator/util"
-	goList "github.com/kmoe/go-list"
-	refsParser "github.com/radeksimko/go-refs/parser"
+	"golang.org/x/tools/go/packages"
 )
 
 type Offence struct {
@@ -20,170 +26,462 @@ type Offence struct {
 type identDeprecation struct {
 	ImportPath string
 	Identifier *ast.Ident
-	Message    string
-}
-
-var deprecations = []*identDeprecation{
-	{
-		"github.com/hashicorp/terraform/httpclient",
-		ast.NewIdent("UserAgentString"),
-		"This function has been removed, please use httpclient.TerraformUserAgent(version) instead",
-	},
-	{
-		"github.com/hashicorp/terraform/httpclient",
-		ast.NewIdent("New"),
-		"This function has been removed, please use DefaultPooledClient() with custom Transport/round-tripper from github.com/hashicorp/go-cleanhttp instead",
-	},
-	{
-		"github.com/hashicorp/terraform/terraform",
-		ast.NewIdent("UserAgentString"),
-		"This function has been removed, please use httpclient.TerraformUserAgent(version) instead",
-	},
-	{
-		"github.com/hashicorp/terraform/terraform",
-		ast.NewIdent("VersionString"),
-		"This function has been removed, please use helper/schema's Provider.TerraformVersion available from Provider.ConfigureFunc",
-	},
-	{
-		"github.com/hashicorp/terraform/config",
-		ast.NewIdent("UserAgentString"),
-		"Please don't use this",
-	},
-	{
-		"github.com/hashicorp/terraform/config",
-		ast.NewIdent("NewRawConfig"),
-		"terraform.NewResourceConfig and config.NewRawConfig have been removed, please use terraform.NewResourceConfigRaw",
-	},
-	{
-		"github.com/hashicorp/terraform/terraform",
-		ast.NewIdent("NewResourceConfig"),
-		"terraform.NewResourceConfig and config.NewRawConfig have been removed, please use terraform.NewResourceConfigRaw",
-	},
-}
-
-// ProviderImports is a data structure we parse the `go list` output into
-// for efficient searching
+
+	// TypeName is set for methods and struct fields, and names the type
+	// in ImportPath they belong to
+	TypeName string
+
+	Message     string
+	Replacement string
+
+	// Fix optionally rewrites a reference automatically
+	Fix fixFunc
+}
+
+// Name returns the qualified name of the deprecated identifier, e.g.
+// NewResourceConfig or ResourceData.Partial.
+func (d *identDeprecation) Name() string {
+	if d.TypeName != "" {
+		return d.TypeName + "." + d.Identifier.Name
+	}
+	return d.Identifier.Name
+}
+
+// ProviderImportDetails holds the packages of a provider, with their
+// tests, as loaded by LoadProviderPackages. Every provider file is
+// parsed once, and all checks share the syntax trees.
 type ProviderImportDetails struct {
+	// AllImportPathsHash holds the imports of the non-test files of the
+	// provider packages.
 	AllImportPathsHash map[string]bool
-	Packages           map[string]ProviderPackage
-}
 
-type ProviderPackage struct {
-	Dir         string
-	ImportPath  string
-	GoFiles     []string
-	TestGoFiles []string
-	Imports     []string
-	TestImports []string
+	cs   *util.Changeset
+	fset *token.FileSet
+
+	// units holds each provider package with its in-package tests, and
+	// its external test package, sorted by import path
+	units []*packages.Package
+
+	// dependencies holds every loaded package by import path, excluding
+	// test variants
+	dependencies map[string]*packages.Package
 }
 
-func GoListPackageImports(providerPath string) (*ProviderImportDetails, error) {
-	packages, err := goList.GoList(providerPath, "./...", "-mod=vendor")
+// LoadProviderPackages loads the packages of the provider at
+// providerPath, with their tests, using go/packages. Provider files are
+// read through cs, or from disk if it is nil, and parsed into a single
+// FileSet. Cancelling ctx stops the go command run to list them.
+//
+// If typed is set, the packages are type-checked. Their dependencies are
+// then loaded from source without function bodies, since only their
+// exported API is needed to resolve references.
+func LoadProviderPackages(ctx context.Context, cs *util.Changeset, providerPath string, typed bool, opts *AnalysisOptions) (*ProviderImportDetails, error) {
+	start := time.Now()
+	stats := opts.stats()
+	if cs == nil {
+		cs = util.NewChangeset()
+	}
+	absProviderPath, err := filepath.Abs(providerPath)
 	if err != nil {
 		return nil, err
 	}
 
-	allImportPathsHash := make(map[string]bool)
-	providerPackages := make(map[string]ProviderPackage)
+	tc := opts.toolchain()
+	if tc.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, tc.Timeout)
+		defer cancel()
+	}
 
-	for _, p := range packages {
-		for _, i := range p.Imports {
-			allImportPathsHash[i] = true
-		}
+	mode := packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedSyntax
+	if typed {
+		mode |= packages.NeedDeps | packages.NeedTypes | packages.NeedTypesInfo
+	}
+	fset := token.NewFileSet()
+	sem := make(chan struct{}, opts.parallelism())
+	cfg := &packages.Config{
+		Mode:       mode,
+		Context:    ctx,
+		Dir:        providerPath,
+		Env:        tc.PathEnviron(),
+		BuildFlags: tc.ModFlags(providerPath),
+		Fset:       fset,
+		Tests:      true,
+		ParseFile: func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			parseStart := time.Now()
+			defer func() { stats.addParse(time.Since(parseStart)) }()
+
+			if !isProviderFile(absProviderPath, filename) {
+				f, err := parser.ParseFile(fset, filename, src, 0)
+				if f != nil {
+					stripFuncBodies(f)
+				}
+				return f, err
+			}
+			src, err := cs.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			return parser.ParseFile(fset, filename, src, parser.ParseComments)
+		},
+	}
 
-		providerPackages[p.ImportPath] = ProviderPackage{
-			Dir:         p.Dir,
-			ImportPath:  p.ImportPath,
-			GoFiles:     p.GoFiles,
-			TestGoFiles: p.TestGoFiles,
-			Imports:     p.Imports,
-			TestImports: p.TestImports,
+	log.Printf("[DEBUG] Loading packages in %s", providerPath)
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, fmt.Errorf("could not load provider packages: %s", err)
+	}
+	stats.Load += time.Since(start)
+
+	details := &ProviderImportDetails{
+		AllImportPathsHash: make(map[string]bool),
+		cs:                 cs,
+		fset:               fset,
+		units:              providerUnits(pkgs),
+		dependencies:       make(map[string]*packages.Package),
+	}
+	providerPackages := make(map[string]bool)
+	for _, p := range details.units {
+		providerPackages[p.PkgPath] = true
+	}
+	for _, p := range pkgs {
+		// skip test variants and generated test mains
+		if p.ID != p.PkgPath || strings.HasSuffix(p.PkgPath, ".test") {
+			continue
+		}
+		for importPath := range p.Imports {
+			details.AllImportPathsHash[importPath] = true
 		}
 	}
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		if p.ID != p.PkgPath {
+			return
+		}
+		details.dependencies[p.PkgPath] = p
+		if typed && !providerPackages[p.PkgPath] {
+			stats.addImport(len(p.Syntax))
+		}
+	})
+
+	stats.Total += time.Since(start)
+	return details, nil
+}
 
-	return &ProviderImportDetails{
-		AllImportPathsHash: allImportPathsHash,
-		Packages:           providerPackages,
-	}, nil
+// isProviderFile reports whether filename belongs to the provider at
+// providerPath rather than to a vendored dependency or one outside of
+// it. Dependencies in nested modules are parsed in full, which is only
+// slower.
+func isProviderFile(providerPath, filename string) bool {
+	rel, err := filepath.Rel(providerPath, filepath.Dir(filename))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(rel), "/") {
+		if elem == "vendor" {
+			return false
+		}
+	}
+	return true
 }
 
-func CheckSDKPackageRefs(providerImportDetails *ProviderImportDetails) ([]*Offence, error) {
+func CheckSDKPackageRefs(details *ProviderImportDetails, rules *Ruleset, opts *AnalysisOptions) ([]*Offence, error) {
+	refs, err := findReferences(details, rules, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make(map[*identDeprecation][]*token.Position)
+	for _, ref := range refs {
+		position := ref.fset.Position(ref.ident.Pos())
+		positions[ref.deprecation] = append(positions[ref.deprecation], &position)
+	}
+
 	offences := make([]*Offence, 0, 0)
+	for _, d := range rules.deprecations {
+		if len(positions[d]) > 0 {
+			offences = append(offences, &Offence{
+				IdentDeprecation: d,
+				Positions:        positions[d],
+			})
+		}
+	}
+
+	return offences, nil
+}
 
-	for _, d := range deprecations {
-		fset := token.NewFileSet()
-		files, err := filesWhichImport(providerImportDetails, d.ImportPath)
-		if err != nil {
-			return nil, err
+// reference is a use of a deprecated identifier, resolved to the object
+// it denotes through type information.
+type reference struct {
+	deprecation *identDeprecation
+	fset        *token.FileSet
+	file        *parsedFile
+	ident       *ast.Ident
+	object      types.Object
+}
+
+type parsedFile struct {
+	path string
+	ast  *ast.File
+}
+
+// findReferences returns all references to deprecated identifiers in
+// the provider packages of details which can refer to one, in file
+// order. All rules are evaluated in a single walk over each file, and
+// the packages are analysed concurrently.
+//
+// References are matched on the types.Object they resolve to, so local
+// shadowing, aliased imports, dot imports and method values are all
+// handled. If a package or a deprecated package it imports cannot be
+// loaded, references to deprecated packages fall back to being matched
+// syntactically.
+func findReferences(details *ProviderImportDetails, rules *Ruleset, opts *AnalysisOptions) ([]*reference, error) {
+	start := time.Now()
+	stats := opts.stats()
+
+	units := []*packages.Package{}
+	for _, unit := range details.units {
+		if usesDeprecatedPackage(unit, rules) {
+			units = append(units, unit)
 		}
+	}
+	members := memberObjects(details.dependencies, rules)
 
-		foundPositions := make([]*token.Position, 0, 0)
+	workers := opts.parallelism()
+	if workers > len(units) {
+		workers = len(units)
+	}
 
-		for _, filePath := range files {
-			f, err := parser.ParseFile(fset, filePath, nil, 0)
-			if err != nil {
-				return nil, err
+	results := make([][]*reference, len(units))
+	errs := make([]error, len(units))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = findUnitReferences(details.cs, details.fset, units[i], details.dependencies, members, rules, stats)
 			}
+		}()
+	}
+	for i := range units {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	refs := []*reference{}
+	for i := range units {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		refs = append(refs, results[i]...)
+	}
+
+	stats.Workers = workers
+	stats.Total += time.Since(start)
+
+	return refs, nil
+}
 
-			identifiers, err := refsParser.FindPackageReferences(f, d.ImportPath)
+// providerUnits selects the units of analysis among the loaded packages:
+// each provider package with its in-package tests, and its external
+// test package. Units are sorted by import path.
+func providerUnits(pkgs []*packages.Package) []*packages.Package {
+	ids := make(map[string]bool, len(pkgs))
+	for _, p := range pkgs {
+		ids[p.ID] = true
+	}
+
+	units := []*packages.Package{}
+	for _, p := range pkgs {
+		// skip generated test mains, and packages whose tests are
+		// analysed along with them
+		if strings.HasSuffix(p.PkgPath, ".test") || p.ID == p.PkgPath && ids[fmt.Sprintf("%s [%s.test]", p.PkgPath, p.PkgPath)] {
+			continue
+		}
+		units = append(units, p)
+	}
+
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].PkgPath < units[j].PkgPath
+	})
+	return units
+}
+
+func findUnitReferences(cs *util.Changeset, fset *token.FileSet, unit *packages.Package, dependencies map[string]*packages.Package, members map[types.Object]*identDeprecation, rules *Ruleset, stats *AnalysisStats) ([]*reference, error) {
+	for _, err := range unit.Errors {
+		log.Printf("[DEBUG] Loading %s: %s", unit.ID, err)
+	}
+
+	files := make([]*parsedFile, 0, len(unit.Syntax))
+	for _, f := range unit.Syntax {
+		files = append(files, &parsedFile{path: fset.File(f.Pos()).Name(), ast: f})
+	}
+	loaded := unit.TypesInfo != nil && len(files) > 0
+	if len(files) == 0 {
+		// the package could not be loaded, e.g. because go list failed
+		for _, filePath := range unit.GoFiles {
+			src, err := cs.ReadFile(filePath)
 			if err != nil {
-				// package not imported in this file
-				continue
+				return nil, err
 			}
-
-			positions, err := findIdentifierPositions(fset, identifiers, d.Identifier)
+			f, err := parser.ParseFile(fset, filePath, src, parser.ParseComments)
 			if err != nil {
 				return nil, err
 			}
+			files = append(files, &parsedFile{path: filePath, ast: f})
+		}
+	}
+	stats.addUnit(len(files))
+
+	refs := []*reference{}
+	for _, file := range files {
+		tokenFile := fset.File(file.ast.Pos())
 
-			if len(positions) > 0 {
-				foundPositions = append(foundPositions, positions...)
+		for _, d := range rules.deprecations {
+			if d.TypeName != "" || rules.deprecation(d.ImportPath, d.Identifier.Name) != d {
+				// overridden by an earlier rule
+				continue
+			}
+			if !loaded || loadFailed(dependencies, d.ImportPath) {
+				refs = append(refs, findSyntacticReferences(fset, file, d)...)
 			}
 		}
-
-		if len(foundPositions) > 0 {
-			offences = append(offences, &Offence{
-				IdentDeprecation: d,
-				Positions:        foundPositions,
-			})
+		if !loaded {
+			continue
 		}
+
+		ast.Inspect(file.ast, func(n ast.Node) bool {
+			ident, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			obj, ok := unit.TypesInfo.Uses[ident]
+			if !ok || fset.File(ident.Pos()) != tokenFile {
+				return true
+			}
+			d := rules.deprecationFor(obj)
+			if d == nil {
+				d = members[obj]
+			}
+			if d != nil {
+				refs = append(refs, &reference{
+					deprecation: d,
+					fset:        fset,
+					file:        file,
+					ident:       ident,
+					object:      obj,
+				})
+			}
+			return true
+		})
 	}
 
-	return offences, nil
+	// files are parsed concurrently, so their positions are not in file
+	// order
+	sort.SliceStable(refs, func(i, j int) bool {
+		pi, pj := fset.Position(refs[i].ident.Pos()), fset.Position(refs[j].ident.Pos())
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		return pi.Offset < pj.Offset
+	})
+	return refs, nil
 }
 
-func findIdentifierPositions(fset *token.FileSet, nodes []ast.Node, ident *ast.Ident) ([]*token.Position, error) {
-	positions := make([]*token.Position, 0, 0)
+// loadFailed reports whether the package at path was imported, but
+// could not be loaded at all.
+func loadFailed(dependencies map[string]*packages.Package, path string) bool {
+	p, ok := dependencies[path]
+	return ok && len(p.Errors) > 0 && (p.Types == nil || p.Types.Scope().Len() == 0)
+}
 
-	for _, node := range nodes {
-		nodeName := fmt.Sprint(node)
-		if nodeName == ident.String() {
-			position := fset.Position(node.Pos())
-			positions = append(positions, &position)
+// stripFuncBodies removes the function bodies of f, which are not
+// needed to type-check importers of its package.
+func stripFuncBodies(f *ast.File) {
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok {
+			fd.Body = nil
 		}
 	}
+}
+
+// findSyntacticReferences finds qualified references to d in file
+// without type information.
+func findSyntacticReferences(fset *token.FileSet, file *parsedFile, d *identDeprecation) []*reference {
+	pkgName := util.ImportName(file.ast, d.ImportPath)
+	if pkgName == "" {
+		return nil
+	}
+	log.Printf("[WARN] Could not import %s in %s, falling back to syntactic matching", d.ImportPath, file.path)
 
-	return positions, nil
+	refs := []*reference{}
+	for _, fc := range findQualifiedRefs(fset, file.ast, pkgName, d.Identifier.Name) {
+		refs = append(refs, &reference{
+			deprecation: d,
+			fset:        fset,
+			file:        file,
+			ident:       fc.ref.Sel,
+		})
+	}
+	return refs
 }
 
-func filesWhichImport(providerImportDetails *ProviderImportDetails, importPath string) (files []string, e error) {
-	files = []string{}
-	for _, p := range providerImportDetails.Packages {
-		if util.StringSliceContains(p.Imports, importPath) {
-			files = append(files, prependDirToFilePaths(p.GoFiles, p.Dir)...)
+// memberObjects resolves the deprecated methods and struct fields of
+// the loaded packages to the objects denoting them. Uses of a method or
+// field, including promoted ones and keys in composite literals,
+// resolve to the same object.
+func memberObjects(dependencies map[string]*packages.Package, rules *Ruleset) map[types.Object]*identDeprecation {
+	members := make(map[types.Object]*identDeprecation)
+	for _, d := range rules.deprecations {
+		if d.TypeName == "" {
+			continue
+		}
+		p, ok := dependencies[d.ImportPath]
+		if !ok || p.Types == nil {
+			continue
+		}
+		pkg := p.Types
+		typeName, ok := pkg.Scope().Lookup(d.TypeName).(*types.TypeName)
+		if !ok {
+			log.Printf("[DEBUG] Type %s not found in %s", d.TypeName, d.ImportPath)
+			continue
 		}
-		if util.StringSliceContains(p.TestImports, importPath) {
-			files = append(files, prependDirToFilePaths(p.TestGoFiles, p.Dir)...)
+		obj, _, _ := types.LookupFieldOrMethod(typeName.Type(), true, pkg, d.Identifier.Name)
+		if obj == nil {
+			log.Printf("[DEBUG] %s not found in %s", d.Name(), d.ImportPath)
+			continue
+		}
+		if _, ok := members[obj]; !ok {
+			members[obj] = d
 		}
 	}
-
-	return files, nil
+	return members
 }
 
-func prependDirToFilePaths(filePaths []string, dir string) []string {
-	newFilePaths := []string{}
-	for _, f := range filePaths {
-		newFilePaths = append(newFilePaths, path.Join(dir, f))
+// usesDeprecatedPackage reports whether the unit p can refer to a
+// deprecated identifier. Methods and fields can be used through values
+// of types from indirect dependencies as well.
+func usesDeprecatedPackage(p *packages.Package, rules *Ruleset) bool {
+	imported := make([]*packages.Package, 0, len(p.Imports))
+	for _, dep := range p.Imports {
+		imported = append(imported, dep)
+	}
+	deps := make(map[string]bool)
+	packages.Visit(imported, nil, func(dep *packages.Package) {
+		deps[dep.PkgPath] = true
+	})
+
+	for _, d := range rules.deprecations {
+		if _, ok := p.Imports[d.ImportPath]; ok {
+			return true
+		}
+		if d.TypeName != "" && deps[d.ImportPath] {
+			return true
+		}
 	}
-	return newFilePaths
+	return false
 }
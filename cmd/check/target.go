@@ -0,0 +1,81 @@
+package check
+
+// Target is a migration a provider is checked for: from the SDK
+// generation it depends on to the next one.
+type Target struct {
+	From SDKGeneration
+	To   SDKGeneration
+
+	// Command is the tf-sdk-migrator command performing the migration.
+	Command string
+
+	// Migrated and Migrating describe the migration in messages, e.g.
+	// "migrated to the new SDK".
+	Migrated  string
+	Migrating string
+
+	GoVersionConstraint   string
+	FromVersionConstraint string
+	ToVersionConstraint   string
+
+	defaultRuleset string
+}
+
+var (
+	// TargetSDKv1 is the migration from Terraform to SDK v1, performed
+	// by the migrate command.
+	TargetSDKv1 = &Target{
+		From:                  GenerationTerraform,
+		To:                    GenerationSDKv1,
+		Command:               "migrate",
+		Migrated:              "migrated to the new SDK",
+		Migrating:             "migrating to the new SDK",
+		GoVersionConstraint:   goVersionConstraint,
+		FromVersionConstraint: tfVersionConstraint,
+		ToVersionConstraint:   sdkVersionConstraint,
+		defaultRuleset:        defaultRuleset,
+	}
+
+	// TargetSDKv2 is the upgrade from SDK v1 to SDK v2, performed by the
+	// v2upgrade command.
+	TargetSDKv2 = &Target{
+		From:                  GenerationSDKv1,
+		To:                    GenerationSDKv2,
+		Command:               "v2upgrade",
+		Migrated:              "upgraded to SDK v2",
+		Migrating:             "upgrading to SDK v2",
+		GoVersionConstraint:   sdkV2GoVersionConstraint,
+		FromVersionConstraint: sdkV2UpgradeVersionConstraint,
+		ToVersionConstraint:   sdkV2VersionConstraint,
+		defaultRuleset:        v2Ruleset,
+	}
+)
+
+// subChecks returns the names of the sub-checks run for t, in order.
+func (t *Target) subChecks() []string {
+	return []string{
+		SubCheckGoVersion,
+		SubCheckGoDirective,
+		SubCheckGoToolchain,
+		SubCheckGoModules,
+		versionSubCheck(t.To),
+		versionSubCheck(t.From),
+		SubCheckModuleDirectives,
+		SubCheckTransitiveDeps,
+		SubCheckSDKGenerations,
+		SubCheckRemovedPackages,
+		SubCheckRemovedIdentifiers,
+	}
+}
+
+// versionSubCheck returns the name of the sub-check of the version of
+// the module of generation g the provider depends on.
+func versionSubCheck(g SDKGeneration) string {
+	switch g {
+	case GenerationTerraform:
+		return SubCheckTerraformVersion
+	case GenerationSDKv2:
+		return SubCheckSDKv2Version
+	}
+	return SubCheckSDKVersion
+}
@@ -0,0 +1,112 @@
+package rollback
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+	"github.com/mitchellh/cli"
+)
+
+const CommandName = "rollback"
+
+type command struct {
+	ui cli.Ui
+}
+
+func CommandFactory(ui cli.Ui) func() (cli.Command, error) {
+	return func() (cli.Command, error) {
+		return &command{ui}, nil
+	}
+}
+
+func (c *command) Help() string {
+	return `Usage: tf-sdk-migrator rollback [--help] [--force] [IMPORT_PATH]
+
+  Undoes the last migrate, v2upgrade or check --fix run against the
+  Terraform provider at PATH, restoring every file it changed (including
+  go.mod and go.sum) from the journal recorded during that run.
+
+  IMPORT_PATH is resolved relative to $GOPATH/src/IMPORT_PATH. If it is not supplied,
+  it is assumed that the current working directory contains a Terraform provider.
+
+  Files which were modified after the run completed are not overwritten
+  unless --force is passed.
+
+Example:
+  tf-sdk-migrator rollback github.com/terraform-providers/terraform-provider-local`
+}
+
+func (c *command) Synopsis() string {
+	return "Undoes the last migration of a Terraform provider."
+}
+
+func (c *command) Run(args []string) int {
+	flags := flag.NewFlagSet(CommandName, flag.ExitOnError)
+	var force bool
+	flags.BoolVar(&force, "force", false, "Whether to overwrite files modified after the run")
+	flags.Parse(args)
+
+	var providerRepoName string
+	var providerPath string
+	if flags.NArg() == 1 {
+		var err error
+		providerRepoName = flags.Args()[0]
+		providerPath, err = util.GetProviderPath(providerRepoName)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error finding provider %s: %s", providerRepoName, err))
+			return 1
+		}
+	} else if flags.NArg() == 0 {
+		var err error
+		providerPath, err = os.Getwd()
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error finding current working directory: %s", err))
+			return 1
+		}
+	} else {
+		return cli.RunResultHelp
+	}
+
+	journal, err := util.LoadJournal(providerPath)
+	if os.IsNotExist(err) {
+		c.ui.Error(fmt.Sprintf("No journal found for %s, nothing to roll back.", providerPath))
+		return 1
+	}
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error reading journal: %s", err))
+		return 1
+	}
+
+	if journal.Completed {
+		modified, err := journal.Modified()
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error comparing files against journal: %s", err))
+			return 1
+		}
+		if len(modified) > 0 {
+			c.ui.Warn(fmt.Sprintf("Files modified since the %s run completed:", journal.Command))
+			for _, path := range modified {
+				c.ui.Warn(fmt.Sprintf(" * %s", path))
+			}
+			if !force {
+				c.ui.Error("Refusing to overwrite modified files. Pass --force to roll back anyway.")
+				return 1
+			}
+		}
+	} else {
+		c.ui.Warn(fmt.Sprintf("The %s run started at %s did not complete.",
+			journal.Command, journal.StartedAt.Local().Format("2006-01-02 15:04:05")))
+	}
+
+	c.ui.Output(fmt.Sprintf("Restoring %d files...", len(journal.Files)))
+	err = journal.Restore()
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error restoring files: %s", err))
+		return 1
+	}
+
+	c.ui.Info(fmt.Sprintf("Success! The %s run has been rolled back.", journal.Command))
+	return 0
+}
@@ -0,0 +1,185 @@
+package v2check
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/hashicorp/tf-sdk-migrator/cmd/check"
+	"github.com/hashicorp/tf-sdk-migrator/util"
+	"github.com/mitchellh/cli"
+)
+
+const (
+	CommandName = "v2check"
+
+	formatText = "text"
+	formatCSV  = "csv"
+)
+
+type command struct {
+	ui cli.Ui
+}
+
+func CommandFactory(ui cli.Ui) func() (cli.Command, error) {
+	return func() (cli.Command, error) {
+		return &command{ui}, nil
+	}
+}
+
+func (c *command) Help() string {
+	return `Usage: tf-sdk-migrator v2check [--help] [--format FORMAT] [--rules PATH]...
+       [--parallelism N] [--verbose] [--go-bin PATH] [--goflags FLAGS]
+       [--goproxy URL] [--goprivate PATTERNS] [--go-timeout DURATION] [IMPORT_PATH]
+
+  Checks whether the Terraform provider at PATH is ready to be upgraded from
+  version 1 to version 2 of the Terraform provider SDK with
+  tf-sdk-migrator v2upgrade.
+
+  The provider must use Go modules and depend on SDK v1.17.2 or later,
+  the last v1 release, which deprecates everything removed in v2.
+  Neither it nor its dependencies may use packages or identifiers of
+  SDK v1 which no longer exist in SDK v2. The go binary and the go
+  directive in go.mod should be Go 1.14 or later, as required by SDK v2.
+
+  IMPORT_PATH is resolved relative to $GOPATH/src/IMPORT_PATH. If it is not supplied,
+  it is assumed that the current working directory contains a Terraform provider.
+
+  By default, outputs a human-readable report and exits 0 if the provider is
+  ready for the upgrade or already upgraded, 1 otherwise. Modules of
+  multi-module repositories are checked separately, as by the check
+  command.
+
+Options:
+  --format Output format: text (default), csv, json or sarif, as for
+           the check command. The json report has a target of sdk_v1 to
+           sdk_v2, and the version of SDK v2 in sdkV2.
+  --csv    Alias for --format=csv.
+  --rules  Load a JSON ruleset file, or every *.json ruleset in a
+           directory, in addition to the built-in rules for SDK v2. May
+           be repeated. Later rulesets take precedence.
+  --parallelism
+           Maximum number of packages to analyse, and of files to
+           parse, concurrently. Defaults to the number of CPUs.
+  --verbose
+           Print timing statistics for the analysis.
+
+  The go tool is run as configured by --go-bin, --goflags, --goproxy,
+  --goprivate and --go-timeout, see the check command.
+
+Example:
+  tf-sdk-migrator v2check github.com/terraform-providers/terraform-provider-local
+`
+}
+
+func (c *command) Synopsis() string {
+	return "Checks whether a Terraform provider is ready to be upgraded to SDK v2."
+}
+
+func (c *command) Run(args []string) int {
+	flags := flag.NewFlagSet(CommandName, flag.ExitOnError)
+	var format string
+	flags.StringVar(&format, "format", formatText, "Output format: text, csv, json or sarif")
+	var csv bool
+	flags.BoolVar(&csv, "csv", false, "CSV output, alias for --format=csv")
+	var rulesPaths util.StringSliceFlag
+	flags.Var(&rulesPaths, "rules", "Ruleset file or directory to load in addition to the built-in rules")
+	var parallelism int
+	flags.IntVar(&parallelism, "parallelism", runtime.NumCPU(), "Maximum number of packages to analyse, and of files to parse, concurrently")
+	var verbose bool
+	flags.BoolVar(&verbose, "verbose", false, "Print timing statistics")
+	tc := util.NewToolchain()
+	tc.AddFlags(flags)
+	flags.Parse(args)
+
+	if csv {
+		format = formatCSV
+	}
+	reporter, err := check.NewReporter(format, c.ui)
+	if err != nil {
+		c.ui.Error(err.Error())
+		return 1
+	}
+
+	if parallelism < 1 {
+		c.ui.Error(fmt.Sprintf("Invalid --parallelism %d: must be at least 1", parallelism))
+		return 1
+	}
+
+	var providerRepoName string
+	var providerPath string
+	if flags.NArg() == 1 {
+		var err error
+		providerRepoName = flags.Args()[0]
+		providerPath, err = util.GetProviderPath(providerRepoName)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error finding provider %s: %s", providerRepoName, err))
+			return 1
+		}
+	} else if flags.NArg() == 0 {
+		var err error
+		providerPath, err = os.Getwd()
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error finding current working directory: %s", err))
+			return 1
+		}
+	} else {
+		return cli.RunResultHelp
+	}
+
+	rules, err := check.TargetSDKv2.LoadRuleset(rulesPaths)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error loading rules: %s", err))
+		return 1
+	}
+
+	opts := &check.AnalysisOptions{Parallelism: parallelism, Toolchain: tc}
+	if verbose {
+		opts.Stats = &check.AnalysisStats{}
+	}
+
+	ctx, cancel := util.InterruptContext()
+	defer cancel()
+
+	results, err := check.TargetSDKv2.CheckModules(ctx, providerPath, providerRepoName, rules, nil, opts)
+	if err != nil {
+		c.ui.Error(err.Error())
+		return 1
+	}
+	if len(results) == 1 {
+		err = reporter.Report(results[0])
+	} else {
+		err = reporter.ReportModules(providerPath, results)
+	}
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error reporting results: %s", err))
+		return 1
+	}
+
+	exitCode := 0
+	for _, result := range results {
+		err := result.Err()
+		if err == nil {
+			continue
+		}
+		msg := err.Error()
+		if len(results) > 1 {
+			msg = fmt.Sprintf("Module %s: %s", result.ProviderName, strings.TrimSpace(msg))
+		}
+
+		if _, alreadyMigrated := err.(*check.AlreadyMigrated); alreadyMigrated {
+			if format == formatText {
+				c.ui.Info(msg)
+			}
+			continue
+		}
+		if format != formatCSV {
+			c.ui.Error(msg)
+		}
+		exitCode = 1
+	}
+
+	return exitCode
+}
@@ -0,0 +1,609 @@
+package v2upgrade
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+)
+
+const (
+	schemaPackagePath  = newPackagePath + "/helper/schema"
+	diagPackagePath    = newPackagePath + "/diag"
+	contextPackagePath = "context"
+)
+
+// codemod rewrites provider code using SDK v1 APIs which changed in
+// SDK v2. Codemods run with --fix after import paths are rewritten, so
+// they see the import paths of SDK v2.
+type codemod struct {
+	// description is printed before the codemod runs, and summary,
+	// formatted with the number of changes, after it ran.
+	description string
+	summary     string
+
+	// apply rewrites pkg in place, marking the files it modified. It
+	// returns the number of changes made and the code which could not
+	// be converted.
+	apply func(pkg *codemodPackage) (int, []*codemodIssue)
+}
+
+// codemods are run in order by v2upgrade --fix.
+var codemods = []*codemod{
+	{
+		description: "Converting CRUD functions to context-aware variants...",
+		summary:     "Converted %d CRUD functions.",
+		apply:       convertCRUDFuncs,
+	},
+	{
+		description: "Converting provider ConfigureFunc to ConfigureContextFunc...",
+		summary:     "Converted %d provider configure functions.",
+		apply:       convertConfigureFuncs,
+	},
+	{
+		description: "Converting acceptance test Providers to ProviderFactories...",
+		summary:     "Converted %d maps of providers.",
+		apply:       convertProviderFactories,
+	},
+	{
+		description: "Converting functions returning terraform.ResourceProvider to *schema.Provider...",
+		summary:     "Converted %d provider functions.",
+		apply:       convertProviderFuncs,
+	},
+	{
+		description: "Renaming removed helper/validation functions...",
+		summary:     "Renamed %d references to removed helper/validation functions.",
+		apply:       renameValidationFuncs,
+	},
+}
+
+// codemodIssue is code which a codemod could not convert safely and
+// needs manual attention.
+type codemodIssue struct {
+	Position token.Position
+	Message  string
+}
+
+// codemodPackage holds the parsed files of a provider package, as
+// staged in the changeset.
+type codemodPackage struct {
+	fset       *token.FileSet
+	importPath string
+	files      []*codemodFile
+
+	// packages holds every package loaded along with this one, other
+	// than external test packages, by import path.
+	packages map[string]*codemodPackage
+}
+
+type codemodFile struct {
+	path     string
+	ast      *ast.File
+	modified bool
+}
+
+// issue returns a codemodIssue at pos.
+func (pkg *codemodPackage) issue(pos token.Pos, format string, args ...interface{}) *codemodIssue {
+	return &codemodIssue{
+		Position: pkg.fset.Position(pos),
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// loadCodemodPackages parses every .go file under providerPath, a
+// directory of module m, skipping vendored dependencies and nested
+// modules like util.RewriteImports, and groups the files by package.
+func loadCodemodPackages(cs *util.Changeset, m *util.Module, providerPath string) ([]*codemodPackage, error) {
+	fset := token.NewFileSet()
+	packages := make(map[string]*codemodPackage)
+	byImportPath := make(map[string]*codemodPackage)
+	var keys []string
+
+	err := filepath.Walk(providerPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && (info.Name() == "vendor" || path != providerPath && util.HasGoMod(path)) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".go") {
+			return nil
+		}
+
+		src, err := cs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+
+		dir := filepath.Dir(path)
+		key := dir + " " + f.Name.Name
+		pkg, ok := packages[key]
+		if !ok {
+			importPath := m.Path
+			if rel, err := filepath.Rel(m.Dir, dir); err == nil && rel != "." {
+				importPath += "/" + filepath.ToSlash(rel)
+			}
+			pkg = &codemodPackage{fset: fset, importPath: importPath, packages: byImportPath}
+			packages[key] = pkg
+			keys = append(keys, key)
+			if !strings.HasSuffix(f.Name.Name, "_test") {
+				byImportPath[importPath] = pkg
+			}
+		}
+		pkg.files = append(pkg.files, &codemodFile{path: path, ast: f})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+	result := make([]*codemodPackage, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, packages[key])
+	}
+	return result, nil
+}
+
+// write stages the files of pkg which were modified in cs.
+func (pkg *codemodPackage) write(cs *util.Changeset) error {
+	for _, file := range pkg.files {
+		if !file.modified {
+			continue
+		}
+		content, err := util.FormatFile(pkg.fset, file.ast)
+		if err != nil {
+			return err
+		}
+		err = cs.WriteFile(file.path, content)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCodemods applies every codemod to the packages under dir, in module
+// m, and stages the changes in cs, printing a summary of each codemod and
+// the code needing manual attention.
+func (c *command) runCodemods(cs *util.Changeset, m *util.Module, dir, providerPath string) error {
+	packages, err := loadCodemodPackages(cs, m, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, cm := range codemods {
+		c.ui.Output(cm.description)
+		changes := 0
+		var issues []*codemodIssue
+		for _, pkg := range packages {
+			n, pkgIssues := cm.apply(pkg)
+			changes += n
+			issues = append(issues, pkgIssues...)
+		}
+		c.ui.Output(fmt.Sprintf(cm.summary, changes))
+		c.warnCodemodIssues("The following code could not be converted and needs manual attention:", issues, providerPath)
+	}
+
+	for _, pkg := range packages {
+		err = pkg.write(cs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warnCodemodIssues prints issues, if there are any, after heading.
+func (c *command) warnCodemodIssues(heading string, issues []*codemodIssue, providerPath string) {
+	if len(issues) == 0 {
+		return
+	}
+	c.ui.Warn(heading)
+	for _, issue := range issues {
+		position := issue.Position
+		if rel, err := filepath.Rel(providerPath, position.Filename); err == nil {
+			position.Filename = rel
+		}
+		c.ui.Warn(fmt.Sprintf(" * %s: %s", position, issue.Message))
+	}
+}
+
+// packageFunc is a function declared in a package.
+type packageFunc struct {
+	decl *ast.FuncDecl
+	file *codemodFile
+}
+
+// packageFuncs returns the functions declared in pkg with a body, other
+// than methods, by name.
+func packageFuncs(pkg *codemodPackage) map[string]*packageFunc {
+	funcs := make(map[string]*packageFunc)
+	for _, file := range pkg.files {
+		for _, d := range file.ast.Decls {
+			if fd, ok := d.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Body != nil {
+				funcs[fd.Name.Name] = &packageFunc{fd, file}
+			}
+		}
+	}
+	return funcs
+}
+
+// packageVar is a variable declared at the top level of a package.
+type packageVar struct {
+	spec *ast.ValueSpec
+	file *codemodFile
+}
+
+// packageVars returns the variables declared at the top level of pkg, by
+// name.
+func packageVars(pkg *codemodPackage) map[string]*packageVar {
+	vars := make(map[string]*packageVar)
+	for _, file := range pkg.files {
+		for _, d := range file.ast.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for _, name := range vs.Names {
+					vars[name.Name] = &packageVar{vs, file}
+				}
+			}
+		}
+	}
+	return vars
+}
+
+// sortIssues sorts issues by position.
+func sortIssues(issues []*codemodIssue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		pi, pj := issues[i].Position, issues[j].Position
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		return pi.Offset < pj.Offset
+	})
+}
+
+// insideFuncLit reports whether stack, the ancestors of a node, holds a
+// function literal.
+func insideFuncLit(stack []ast.Node) bool {
+	for _, n := range stack {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// findCtxDecls returns the statements at the top level of body which
+// declare ctx as context.Background() or context.TODO(), which a ctx
+// parameter added to typ replaces. If typ or body declare ctx in any
+// other way, it returns the position of the declaration and false.
+func findCtxDecls(f *ast.File, typ *ast.FuncType, body *ast.BlockStmt) ([]ast.Stmt, token.Pos, bool) {
+	for _, param := range typ.Params.List {
+		for _, name := range param.Names {
+			if name.Name == "ctx" {
+				return nil, name.Pos(), false
+			}
+		}
+	}
+
+	contextName := util.ImportName(f, contextPackagePath)
+	topLevel := make(map[ast.Stmt]bool)
+	for _, stmt := range body.List {
+		topLevel[stmt] = true
+	}
+
+	var ctxDecls []ast.Stmt
+	pos := token.NoPos
+	ast.Inspect(body, func(n ast.Node) bool {
+		if pos.IsValid() {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if n.Tok != token.DEFINE || !declaresCtx(n.Lhs...) {
+				return true
+			}
+			if topLevel[n] && len(n.Lhs) == 1 && len(n.Rhs) == 1 && isBackgroundContext(n.Rhs[0], contextName) {
+				ctxDecls = append(ctxDecls, n)
+				return true
+			}
+			pos = n.Pos()
+		case *ast.RangeStmt:
+			if n.Tok == token.DEFINE && declaresCtx(n.Key, n.Value) {
+				pos = n.Pos()
+			}
+		case *ast.ValueSpec:
+			for _, name := range n.Names {
+				if name.Name == "ctx" {
+					pos = n.Pos()
+				}
+			}
+		}
+		return true
+	})
+	return ctxDecls, pos, !pos.IsValid()
+}
+
+// addCtxParam adds a ctx context.Context parameter to typ, before the
+// others, and removes ctxDecls from body. The parameter is unnamed if
+// typ is a function type without body and unnamed parameters.
+func addCtxParam(pkg *codemodPackage, contextName string, typ *ast.FuncType, body *ast.BlockStmt, ctxDecls []ast.Stmt) {
+	names := []*ast.Ident{ast.NewIdent("ctx")}
+	if len(typ.Params.List) > 0 && len(typ.Params.List[0].Names) == 0 {
+		if body == nil {
+			names = nil
+		} else {
+			for _, param := range typ.Params.List {
+				param.Names = []*ast.Ident{ast.NewIdent("_")}
+			}
+		}
+	}
+	typ.Params.List = append([]*ast.Field{{
+		Names: names,
+		Type:  qualified(contextName, "Context", token.NoPos),
+	}}, typ.Params.List...)
+
+	if len(ctxDecls) == 0 {
+		return
+	}
+	removed := make(map[ast.Stmt]bool)
+	for _, stmt := range ctxDecls {
+		removed[stmt] = true
+		// join the line of the statement with the next one, so that it
+		// does not leave an empty line behind
+		tokFile := pkg.fset.File(stmt.Pos())
+		if line := tokFile.Line(stmt.End()); line < tokFile.LineCount() {
+			tokFile.MergeLine(line)
+		}
+	}
+	list := body.List[:0]
+	for _, stmt := range body.List {
+		if !removed[stmt] {
+			list = append(list, stmt)
+		}
+	}
+	body.List = list
+}
+
+// errorDiagnostics converts the error expression err to
+// diag.Diagnostics: nil is kept, fmt.Errorf becomes diag.Errorf unless
+// it wraps an error with %w, and other errors are wrapped with
+// diag.FromErr.
+func errorDiagnostics(err ast.Expr, diagName, fmtName string) ast.Expr {
+	if ident, ok := err.(*ast.Ident); ok && ident.Name == "nil" && ident.Obj == nil {
+		return err
+	}
+
+	if call, ok := err.(*ast.CallExpr); ok && fmtName != "" && isQualified(call.Fun, fmtName, "Errorf") && len(call.Args) > 0 {
+		if format, ok := call.Args[0].(*ast.BasicLit); ok && format.Kind == token.STRING {
+			s, uerr := strconv.Unquote(format.Value)
+			if uerr == nil && !strings.Contains(s, "%w") {
+				call.Fun = qualified(diagName, "Errorf", call.Fun.Pos())
+				return call
+			}
+		}
+	}
+
+	return &ast.CallExpr{
+		Fun:    qualified(diagName, "FromErr", err.Pos()),
+		Lparen: err.Pos(),
+		Args:   []ast.Expr{err},
+		Rparen: err.End(),
+	}
+}
+
+// isBackgroundContext reports whether expr is context.Background() or
+// context.TODO().
+func isBackgroundContext(expr ast.Expr, contextName string) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || contextName == "" || len(call.Args) != 0 {
+		return false
+	}
+	return isQualified(call.Fun, contextName, "Background") || isQualified(call.Fun, contextName, "TODO")
+}
+
+func declaresCtx(exprs ...ast.Expr) bool {
+	for _, expr := range exprs {
+		if ident, ok := expr.(*ast.Ident); ok && ident.Name == "ctx" {
+			return true
+		}
+	}
+	return false
+}
+
+// firstReference returns the first reference to the package-level
+// function name in pkg, other than those in allowed.
+func firstReference(pkg *codemodPackage, name string, allowed map[*ast.Ident]bool) *ast.Ident {
+	var ref *ast.Ident
+	for _, file := range pkg.files {
+		var stack []ast.Node
+		ast.Inspect(file.ast, func(n ast.Node) bool {
+			if ref != nil {
+				return false
+			}
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			defer func() { stack = append(stack, n) }()
+
+			if ident, ok := n.(*ast.Ident); ok && ident.Name == name && !allowed[ident] && !isDeclaration(ident, stack) {
+				ref = ident
+			}
+			return true
+		})
+		if ref != nil {
+			return ref
+		}
+	}
+	return nil
+}
+
+// describeReference describes the position of ident in messages, e.g.
+// provider.go:12.
+func (pkg *codemodPackage) describeReference(ident *ast.Ident) string {
+	position := pkg.fset.Position(ident.Pos())
+	return fmt.Sprintf("%s:%d", filepath.Base(position.Filename), position.Line)
+}
+
+// replaceExpr replaces the expression old, a child of parent, with
+// new. It reports false if old is not in a position it can replace.
+func replaceExpr(parent ast.Node, old, new ast.Expr) bool {
+	replaceIn := func(exprs []ast.Expr) bool {
+		for i, expr := range exprs {
+			if expr == old {
+				exprs[i] = new
+				return true
+			}
+		}
+		return false
+	}
+
+	switch parent := parent.(type) {
+	case *ast.AssignStmt:
+		return replaceIn(parent.Rhs)
+	case *ast.BinaryExpr:
+		if parent.X == old {
+			parent.X = new
+			return true
+		}
+		if parent.Y == old {
+			parent.Y = new
+			return true
+		}
+	case *ast.CallExpr:
+		if parent.Fun == old {
+			parent.Fun = new
+			return true
+		}
+		return replaceIn(parent.Args)
+	case *ast.CompositeLit:
+		return replaceIn(parent.Elts)
+	case *ast.ExprStmt:
+		if parent.X == old {
+			parent.X = new
+			return true
+		}
+	case *ast.KeyValueExpr:
+		if parent.Value == old {
+			parent.Value = new
+			return true
+		}
+	case *ast.ParenExpr:
+		if parent.X == old {
+			parent.X = new
+			return true
+		}
+	case *ast.ReturnStmt:
+		return replaceIn(parent.Results)
+	case *ast.SelectorExpr:
+		if parent.X == old {
+			parent.X = new
+			return true
+		}
+	case *ast.UnaryExpr:
+		if parent.X == old {
+			parent.X = new
+			return true
+		}
+	case *ast.ValueSpec:
+		return replaceIn(parent.Values)
+	}
+	return false
+}
+
+// replaceStmt replaces the statement old, a child of parent, with
+// stmts. It reports false if old is not in a statement list.
+func replaceStmt(parent ast.Node, old ast.Stmt, stmts ...ast.Stmt) bool {
+	var list *[]ast.Stmt
+	switch parent := parent.(type) {
+	case *ast.BlockStmt:
+		list = &parent.List
+	case *ast.CaseClause:
+		list = &parent.Body
+	case *ast.CommClause:
+		list = &parent.Body
+	default:
+		return false
+	}
+
+	for i, stmt := range *list {
+		if stmt == old {
+			rest := append(stmts, (*list)[i+1:]...)
+			*list = append((*list)[:i], rest...)
+			return true
+		}
+	}
+	return false
+}
+
+// freshName returns name, or name followed by a number, whichever is
+// not used as an identifier in node.
+func freshName(node ast.Node, name string) string {
+	used := make(map[string]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			used[ident.Name] = true
+		}
+		return true
+	})
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+	return candidate
+}
+
+// isDeclaration reports whether ident, with its ancestors in stack, is
+// not a reference to a package-level function: the name of a function
+// declaration, a selected field or method, or a key of a struct
+// literal.
+func isDeclaration(ident *ast.Ident, stack []ast.Node) bool {
+	if len(stack) == 0 {
+		return false
+	}
+	switch parent := stack[len(stack)-1].(type) {
+	case *ast.FuncDecl:
+		return parent.Name == ident
+	case *ast.SelectorExpr:
+		return parent.Sel == ident
+	case *ast.KeyValueExpr:
+		return parent.Key == ident
+	}
+	return false
+}
+
+// isQualified reports whether expr is the qualified identifier
+// pkgName.name.
+func isQualified(expr ast.Expr, pkgName, name string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && x.Obj == nil && x.Name == pkgName
+}
+
+// qualified returns the qualified identifier pkgName.name at pos.
+func qualified(pkgName, name string, pos token.Pos) *ast.SelectorExpr {
+	return &ast.SelectorExpr{
+		X:   &ast.Ident{NamePos: pos, Name: pkgName},
+		Sel: &ast.Ident{NamePos: pos, Name: name},
+	}
+}
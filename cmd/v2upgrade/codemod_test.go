@@ -0,0 +1,93 @@
+package v2upgrade
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+)
+
+var update = flag.Bool("update", false, "update the golden files of codemod tests")
+
+// TestCodemods applies each codemod to the provider in testdata/NAME,
+// and compares every file it modified with FILE.golden, and the code it
+// reported with issues.golden. Run with -update to rewrite them.
+func TestCodemods(t *testing.T) {
+	cases := []struct {
+		name  string
+		apply func(*codemodPackage) (int, []*codemodIssue)
+	}{
+		{"crud_context", convertCRUDFuncs},
+		{"configure_context", convertConfigureFuncs},
+		{"provider_factories", convertProviderFactories},
+		{"provider_func", convertProviderFuncs},
+		{"validation_renames", renameValidationFuncs},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := filepath.Abs(filepath.Join("testdata", tc.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := &util.Module{Dir: dir, Path: "example.com/terraform-provider-example"}
+			packages, err := loadCodemodPackages(util.NewChangeset(), m, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var issues bytes.Buffer
+			for _, pkg := range packages {
+				_, pkgIssues := tc.apply(pkg)
+				for _, issue := range pkgIssues {
+					position := issue.Position
+					if rel, err := filepath.Rel(dir, position.Filename); err == nil {
+						position.Filename = filepath.ToSlash(rel)
+					}
+					fmt.Fprintf(&issues, "%s: %s\n", position, issue.Message)
+				}
+
+				for _, file := range pkg.files {
+					golden := file.path + ".golden"
+					if !file.modified {
+						if _, err := os.Stat(golden); err == nil {
+							t.Errorf("%s was not modified, but %s exists", file.path, golden)
+						}
+						continue
+					}
+					content, err := util.FormatFile(pkg.fset, file.ast)
+					if err != nil {
+						t.Fatal(err)
+					}
+					checkGolden(t, golden, content)
+				}
+			}
+			checkGolden(t, filepath.Join(dir, "issues.golden"), issues.Bytes())
+		})
+	}
+}
+
+func checkGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		name := filepath.Base(path)
+		t.Errorf("%s differs:\n%s", path, strings.TrimSpace(util.UnifiedDiff("a/"+name, "b/"+name, want, got)))
+	}
+}
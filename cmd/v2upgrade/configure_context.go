@@ -0,0 +1,571 @@
+package v2upgrade
+
+import (
+	"go/ast"
+	"go/token"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+)
+
+// configureFunc is a function configuring a provider: a function
+// declared in the package, or a function literal.
+type configureFunc struct {
+	// name is the name of the declared function, or describes the
+	// function literal.
+	name string
+	file *codemodFile
+	pos  token.Pos
+	typ  *ast.FuncType
+	body *ast.BlockStmt
+
+	// ctxDecls are the statements declaring ctx as context.Background()
+	// or context.TODO(), which the ctx parameter replaces.
+	ctxDecls []ast.Stmt
+}
+
+// configureSite is the ConfigureFunc field of a schema.Provider
+// literal, or an assignment to the ConfigureFunc field of a provider.
+type configureSite struct {
+	file  *codemodFile
+	field *ast.Ident
+	value ast.Expr
+}
+
+// convertConfigureFuncs rewrites the ConfigureFunc field of providers to
+// ConfigureContextFunc, and the function it is set to from
+// func(*schema.ResourceData) (interface{}, error) to
+// func(context.Context, *schema.ResourceData) (interface{}, diag.Diagnostics).
+// Returned errors are converted as by convertCRUDFuncs, and calls to
+// StopContext(), such as p.StopContext() for the provider p, are
+// replaced with ctx, or with the stop context ctx holds if they may be
+// used after the configure function returned, see contextStored.
+//
+// The field may be set to a function declared in the package, a
+// function literal, or a call to a function declared in the package
+// returning a schema.ConfigureFunc literal, e.g. to capture the
+// provider, whose result type is rewritten to
+// schema.ConfigureContextFunc. Declared functions which are referenced
+// anywhere else are reported rather than converted.
+func convertConfigureFuncs(pkg *codemodPackage) (int, []*codemodIssue) {
+	var issues []*codemodIssue
+	decls := packageFuncs(pkg)
+
+	var sites []*configureSite
+	for _, file := range pkg.files {
+		schemaName := util.ImportName(file.ast, schemaPackagePath)
+		if schemaName == "" {
+			continue
+		}
+
+		ast.Inspect(file.ast, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CompositeLit:
+				if !isQualified(n.Type, schemaName, "Provider") {
+					return true
+				}
+				var site *configureSite
+				hasContextFunc := false
+				for _, elt := range n.Elts {
+					kv, ok := elt.(*ast.KeyValueExpr)
+					if !ok {
+						continue
+					}
+					key, ok := kv.Key.(*ast.Ident)
+					if !ok {
+						continue
+					}
+					switch key.Name {
+					case "ConfigureFunc":
+						site = &configureSite{file, key, kv.Value}
+					case "ConfigureContextFunc":
+						hasContextFunc = true
+					}
+				}
+				if site != nil && hasContextFunc {
+					issues = append(issues, pkg.issue(site.field.Pos(), "the ConfigureFunc field is set along with ConfigureContextFunc"))
+				} else if site != nil {
+					sites = append(sites, site)
+				}
+			case *ast.AssignStmt:
+				if n.Tok != token.ASSIGN || len(n.Lhs) != 1 || len(n.Rhs) != 1 {
+					return true
+				}
+				sel, ok := n.Lhs[0].(*ast.SelectorExpr)
+				if !ok || sel.Sel.Name != "ConfigureFunc" {
+					return true
+				}
+				if x, ok := sel.X.(*ast.Ident); ok && isProviderVar(x, schemaName) {
+					sites = append(sites, &configureSite{file, sel.Sel, n.Rhs[0]})
+				}
+			}
+			return true
+		})
+	}
+
+	converted := 0
+	for _, site := range sites {
+		var funcs []*configureFunc
+		var issue *codemodIssue
+		var convertFactory func()
+
+		switch v := site.value.(type) {
+		case *ast.FuncLit:
+			funcs = append(funcs, &configureFunc{
+				name: "the function literal of the ConfigureFunc field",
+				file: site.file,
+				pos:  v.Pos(),
+				typ:  v.Type,
+				body: v.Body,
+			})
+		case *ast.Ident:
+			d, ok := decls[v.Name]
+			if !ok || v.Obj != nil && v.Obj.Kind != ast.Fun {
+				issue = pkg.issue(v.Pos(), "the ConfigureFunc field is not set to a function declared in this package")
+				break
+			}
+			if ref := firstReference(pkg, v.Name, map[*ast.Ident]bool{v: true}); ref != nil {
+				issue = pkg.issue(d.decl.Pos(), "%s is also used in %s, which cannot be converted", v.Name, pkg.describeReference(ref))
+				break
+			}
+			funcs = append(funcs, &configureFunc{
+				name: v.Name,
+				file: d.file,
+				pos:  d.decl.Pos(),
+				typ:  d.decl.Type,
+				body: d.decl.Body,
+			})
+		case *ast.CallExpr:
+			funcs, convertFactory, issue = configureFactory(pkg, decls, v)
+		default:
+			issue = pkg.issue(v.Pos(), "the ConfigureFunc field is not set to a function declared in this package")
+		}
+
+		for _, fn := range funcs {
+			if issue != nil {
+				break
+			}
+			issue = checkConfigureFunc(pkg, fn)
+		}
+		if issue != nil {
+			issues = append(issues, issue)
+			continue
+		}
+
+		site.field.Name = "ConfigureContextFunc"
+		site.file.modified = true
+		if convertFactory != nil {
+			convertFactory()
+		}
+		for _, fn := range funcs {
+			issues = append(issues, convertConfigureFunc(pkg, fn)...)
+			converted++
+		}
+	}
+
+	sortIssues(issues)
+	return converted, issues
+}
+
+// configureFactory returns the function literals returned by the
+// function called by call, which a ConfigureFunc field is set to, and a
+// function converting its result type.
+func configureFactory(pkg *codemodPackage, decls map[string]*packageFunc, call *ast.CallExpr) ([]*configureFunc, func(), *codemodIssue) {
+	ident, ok := call.Fun.(*ast.Ident)
+	if !ok {
+		return nil, nil, pkg.issue(call.Pos(), "the ConfigureFunc field is not set to a function declared in this package")
+	}
+	d, ok := decls[ident.Name]
+	if !ok || ident.Obj != nil && ident.Obj.Kind != ast.Fun {
+		return nil, nil, pkg.issue(call.Pos(), "the ConfigureFunc field is not set to a function declared in this package")
+	}
+	if ref := firstReference(pkg, ident.Name, map[*ast.Ident]bool{ident: true}); ref != nil {
+		return nil, nil, pkg.issue(d.decl.Pos(), "%s is also used in %s, which cannot be converted", ident.Name, pkg.describeReference(ref))
+	}
+
+	schemaName := util.ImportName(d.file.ast, schemaPackagePath)
+	results := d.decl.Type.Results
+	if results == nil || len(results.List) != 1 || len(results.List[0].Names) != 0 {
+		return nil, nil, pkg.issue(d.decl.Pos(), "%s does not return a schema.ConfigureFunc", ident.Name)
+	}
+	resultType := results.List[0].Type
+	funcType, isFuncType := resultType.(*ast.FuncType)
+	if !isQualified(resultType, schemaName, "ConfigureFunc") && !(isFuncType && isConfigureSignature(funcType, schemaName)) {
+		return nil, nil, pkg.issue(d.decl.Pos(), "%s does not return a schema.ConfigureFunc", ident.Name)
+	}
+
+	var funcs []*configureFunc
+	var issue *codemodIssue
+	ast.Inspect(d.decl.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			var lit *ast.FuncLit
+			if len(n.Results) == 1 {
+				lit, _ = n.Results[0].(*ast.FuncLit)
+			}
+			if lit == nil {
+				if issue == nil {
+					issue = pkg.issue(n.Pos(), "%s does not return a function literal", ident.Name)
+				}
+				return true
+			}
+			funcs = append(funcs, &configureFunc{
+				name: "the function literal returned by " + ident.Name,
+				file: d.file,
+				pos:  lit.Pos(),
+				typ:  lit.Type,
+				body: lit.Body,
+			})
+		}
+		return true
+	})
+	if issue != nil {
+		return nil, nil, issue
+	}
+
+	convert := func() {
+		d.file.modified = true
+		if sel, ok := resultType.(*ast.SelectorExpr); ok {
+			sel.Sel.Name = "ConfigureContextFunc"
+			return
+		}
+		contextName := util.AddImport(pkg.fset, d.file.ast, contextPackagePath)
+		diagName := util.AddImport(pkg.fset, d.file.ast, diagPackagePath)
+		addCtxParam(pkg, contextName, funcType, nil, nil)
+		funcType.Results.List[1].Type = qualified(diagName, "Diagnostics", funcType.Results.List[1].Type.Pos())
+	}
+	return funcs, convert, nil
+}
+
+// checkConfigureFunc returns an issue if fn does not have the signature
+// of a schema.ConfigureFunc or declares its own ctx.
+func checkConfigureFunc(pkg *codemodPackage, fn *configureFunc) *codemodIssue {
+	schemaName := util.ImportName(fn.file.ast, schemaPackagePath)
+	if !isConfigureSignature(fn.typ, schemaName) {
+		return pkg.issue(fn.pos, "%s does not have the signature func(*schema.ResourceData) (interface{}, error)", fn.name)
+	}
+	ctxDecls, pos, ok := findCtxDecls(fn.file.ast, fn.typ, fn.body)
+	if !ok {
+		return pkg.issue(pos, "%s declares its own ctx", fn.name)
+	}
+	fn.ctxDecls = ctxDecls
+	return nil
+}
+
+// convertConfigureFunc rewrites the signature and return statements of
+// fn, and replaces calls to StopContext() with ctx. SDK v2 cancels ctx
+// once the configure function returned, so calls whose result may be
+// kept are replaced with the stop context which calls to StopContext()
+// returned before, which schema.StopContext(ctx) returns, or with ctx if
+// it does not hold one.
+// Likewise, a ctx declared as context.Background() whose value may be
+// kept, e.g. by config.Client(ctx), keeps its declaration under another
+// name rather than being replaced by the ctx parameter. It returns the
+// calls which could not be replaced.
+func convertConfigureFunc(pkg *codemodPackage, fn *configureFunc) []*codemodIssue {
+	f := fn.file.ast
+	contextName := util.AddImport(pkg.fset, f, contextPackagePath)
+	diagName := util.AddImport(pkg.fset, f, diagPackagePath)
+	fmtName := util.ImportName(f, "fmt")
+	schemaName := util.ImportName(f, schemaPackagePath)
+	fn.file.modified = true
+
+	type returnStmt struct {
+		stmt   *ast.ReturnStmt
+		parent ast.Node
+	}
+	var returns []returnStmt
+	var stopContextCalls []*ast.CallExpr
+	stacks := make(map[ast.Expr][]ast.Node)
+	uses := make(map[*ast.Object][]*ast.Ident)
+	var stack []ast.Node
+	ast.Inspect(fn.body, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		defer func() { stack = append(stack, n) }()
+
+		switch n := n.(type) {
+		case *ast.ReturnStmt:
+			if !insideFuncLit(stack) {
+				returns = append(returns, returnStmt{n, stack[len(stack)-1]})
+			}
+		case *ast.CallExpr:
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "StopContext" && len(n.Args) == 0 {
+				stopContextCalls = append(stopContextCalls, n)
+				stacks[n] = append([]ast.Node(nil), stack...)
+			}
+		case *ast.Ident:
+			if n.Obj != nil && n.Obj.Kind == ast.Var {
+				uses[n.Obj] = append(uses[n.Obj], n)
+				stacks[n] = append([]ast.Node(nil), stack...)
+			}
+		}
+		return true
+	})
+
+	var ctxDecls []ast.Stmt
+	for _, stmt := range fn.ctxDecls {
+		obj := stmt.(*ast.AssignStmt).Lhs[0].(*ast.Ident).Obj
+		if !localContextStored(fn.body, obj, stacks, uses, make(map[*ast.Object]bool)) {
+			ctxDecls = append(ctxDecls, stmt)
+			continue
+		}
+		name := freshName(fn.body, "backgroundCtx")
+		for _, use := range uses[obj] {
+			use.Name = name
+		}
+	}
+	addCtxParam(pkg, contextName, fn.typ, fn.body, ctxDecls)
+	fn.typ.Results.List[1].Type = qualified(diagName, "Diagnostics", fn.typ.Results.List[1].Type.Pos())
+
+	var issues []*codemodIssue
+	for _, ret := range returns {
+		switch len(ret.stmt.Results) {
+		case 2:
+			ret.stmt.Results[1] = errorDiagnostics(ret.stmt.Results[1], diagName, fmtName)
+		case 1:
+			// return config.Client() becomes
+			//   meta, err := config.Client()
+			//   return meta, diag.FromErr(err)
+			meta := freshName(fn.body, "meta")
+			pos, end := ret.stmt.Pos(), ret.stmt.End()
+			assign := &ast.AssignStmt{
+				Lhs:    []ast.Expr{&ast.Ident{NamePos: pos, Name: meta}, &ast.Ident{NamePos: pos, Name: "err"}},
+				TokPos: pos,
+				Tok:    token.DEFINE,
+				Rhs:    ret.stmt.Results,
+			}
+			// the new return statement ends where the old one did, so
+			// that no empty line is printed after it
+			newRet := &ast.ReturnStmt{
+				Return: pos,
+				Results: []ast.Expr{
+					&ast.Ident{NamePos: pos, Name: meta},
+					errorDiagnostics(&ast.Ident{NamePos: end - token.Pos(len("err")), Name: "err"}, diagName, fmtName),
+				},
+			}
+			if !replaceStmt(ret.parent, ret.stmt, assign, newRet) {
+				issues = append(issues, pkg.issue(ret.stmt.Pos(), "the result of %s could not be converted to diag.Diagnostics", fn.name))
+			}
+		}
+	}
+
+	stopCtx := ""
+	for _, call := range stopContextCalls {
+		stack := stacks[call]
+		var ctx ast.Expr = ast.NewIdent("ctx")
+		if contextStored(fn.body, call, stack, stacks, uses, make(map[*ast.Object]bool)) {
+			if stopCtx == "" {
+				stopCtx = freshName(fn.body, "stopCtx")
+			}
+			ctx = ast.NewIdent(stopCtx)
+		}
+		if !replaceExpr(stack[len(stack)-1], call, ctx) {
+			issues = append(issues, pkg.issue(call.Pos(), "the StopContext() call in %s could not be replaced with ctx", fn.name))
+		}
+	}
+	if stopCtx != "" {
+		// stopCtx, ok := schema.StopContext(ctx)
+		// if !ok {
+		// 	stopCtx = ctx
+		// }
+		//
+		// ctx only holds the stop context if the provider is served,
+		// not if it is configured directly, e.g. by unit tests
+		ok := freshName(fn.body, "ok")
+		pos := fn.body.Lbrace
+		decl := &ast.AssignStmt{
+			Lhs:    []ast.Expr{&ast.Ident{NamePos: pos, Name: stopCtx}, &ast.Ident{NamePos: pos, Name: ok}},
+			TokPos: pos,
+			Tok:    token.DEFINE,
+			Rhs: []ast.Expr{&ast.CallExpr{
+				Fun:  qualified(schemaName, "StopContext", pos),
+				Args: []ast.Expr{&ast.Ident{NamePos: pos, Name: "ctx"}},
+			}},
+		}
+		fallback := &ast.IfStmt{
+			If:   pos,
+			Cond: &ast.UnaryExpr{OpPos: pos, Op: token.NOT, X: &ast.Ident{NamePos: pos, Name: ok}},
+			Body: &ast.BlockStmt{List: []ast.Stmt{&ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent(stopCtx)},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{ast.NewIdent("ctx")},
+			}}},
+		}
+		fn.body.List = append([]ast.Stmt{decl, fallback}, fn.body.List...)
+	}
+
+	// fmt.Errorf calls may have been rewritten to diag.Errorf
+	util.DeleteUnusedImport(pkg.fset, f, "fmt")
+	return issues
+}
+
+// contextStored reports whether the value of expr, a context in body
+// such as a StopContext() call, or a use of a variable it was assigned
+// to, may be used after the configure function returned: if it is kept in a composite
+// literal, a field or a variable declared outside body, returned, sent,
+// or used in a function literal or go statement. stack holds the
+// ancestors of expr.
+//
+// The value of an expression using it, such as the result of a call it
+// is passed to, e.g. NewClient(p.StopContext()), is assumed to keep it,
+// unless it is assigned to err or is the Err() or Deadline() of the
+// context itself.
+func contextStored(body *ast.BlockStmt, expr ast.Expr, stack []ast.Node, stacks map[ast.Expr][]ast.Node, uses map[*ast.Object][]*ast.Ident, seen map[*ast.Object]bool) bool {
+	isContext := true
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch parent := stack[i].(type) {
+		case *ast.ParenExpr:
+			expr = parent
+		case *ast.SelectorExpr:
+			if isContext && (parent.Sel.Name == "Err" || parent.Sel.Name == "Deadline") {
+				return false
+			}
+			expr, isContext = parent, false
+		case *ast.CallExpr, *ast.UnaryExpr, *ast.BinaryExpr, *ast.StarExpr, *ast.IndexExpr, *ast.TypeAssertExpr:
+			expr, isContext = parent.(ast.Expr), false
+		case *ast.ExprStmt, *ast.IfStmt, *ast.SwitchStmt, *ast.CaseClause, *ast.DeferStmt:
+			return false
+		case *ast.AssignStmt:
+			var targets []ast.Expr
+			for j, rhs := range parent.Rhs {
+				if rhs != expr {
+					continue
+				}
+				if len(parent.Lhs) == len(parent.Rhs) {
+					targets = []ast.Expr{parent.Lhs[j]}
+				} else {
+					targets = parent.Lhs
+				}
+			}
+			if targets == nil {
+				// expr is assigned to, not read
+				return false
+			}
+			if parent.Tok != token.ASSIGN && parent.Tok != token.DEFINE {
+				return true
+			}
+			for _, target := range targets {
+				ident, ok := target.(*ast.Ident)
+				if ok && (ident.Name == "_" || ident.Name == "err") {
+					continue
+				}
+				if !ok || ident.Obj == nil || !declaredIn(body, ident.Obj) || localContextStored(body, ident.Obj, stacks, uses, seen) {
+					return true
+				}
+			}
+			return false
+		case *ast.ValueSpec:
+			for _, name := range parent.Names {
+				if name.Name != "_" && name.Name != "err" && localContextStored(body, name.Obj, stacks, uses, seen) {
+					return true
+				}
+			}
+			return false
+		default:
+			// composite literals, function literals, return, send and go
+			// statements, and anything else
+			return true
+		}
+	}
+	return true
+}
+
+// localContextStored reports whether a context assigned to obj, a
+// variable declared in body, may be used after the configure function
+// returned through any use of obj.
+func localContextStored(body *ast.BlockStmt, obj *ast.Object, stacks map[ast.Expr][]ast.Node, uses map[*ast.Object][]*ast.Ident, seen map[*ast.Object]bool) bool {
+	if obj == nil || seen[obj] {
+		return obj == nil
+	}
+	seen[obj] = true
+	for _, use := range uses[obj] {
+		if contextStored(body, use, stacks[use], stacks, uses, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// declaredIn reports whether obj is declared in body.
+func declaredIn(body *ast.BlockStmt, obj *ast.Object) bool {
+	decl, ok := obj.Decl.(ast.Node)
+	return ok && decl.Pos() >= body.Pos() && decl.End() <= body.End()
+}
+
+// isConfigureSignature reports whether typ is
+// func(*schema.ResourceData) (interface{}, error).
+func isConfigureSignature(typ *ast.FuncType, schemaName string) bool {
+	if schemaName == "" || typ.Params == nil || len(typ.Params.List) != 1 || len(typ.Params.List[0].Names) > 1 {
+		return false
+	}
+	star, ok := typ.Params.List[0].Type.(*ast.StarExpr)
+	if !ok || !isQualified(star.X, schemaName, "ResourceData") {
+		return false
+	}
+
+	if typ.Results == nil || len(typ.Results.List) != 2 {
+		return false
+	}
+	for _, result := range typ.Results.List {
+		if len(result.Names) != 0 {
+			return false
+		}
+	}
+	iface, ok := typ.Results.List[0].Type.(*ast.InterfaceType)
+	if !ok || len(iface.Methods.List) != 0 {
+		return false
+	}
+	result, ok := typ.Results.List[1].Type.(*ast.Ident)
+	return ok && result.Name == "error"
+}
+
+// isProviderVar reports whether ident refers to a *schema.Provider
+// variable, declared with that type or initialized with a
+// schema.Provider literal.
+func isProviderVar(ident *ast.Ident, schemaName string) bool {
+	if ident.Obj == nil || ident.Obj.Kind != ast.Var {
+		return false
+	}
+
+	switch decl := ident.Obj.Decl.(type) {
+	case *ast.AssignStmt:
+		if len(decl.Lhs) != len(decl.Rhs) {
+			return false
+		}
+		for i, lhs := range decl.Lhs {
+			if lhsIdent, ok := lhs.(*ast.Ident); ok && lhsIdent.Name == ident.Name {
+				return isProviderLit(decl.Rhs[i], schemaName)
+			}
+		}
+	case *ast.ValueSpec:
+		if star, ok := decl.Type.(*ast.StarExpr); ok && isQualified(star.X, schemaName, "Provider") {
+			return true
+		}
+		if len(decl.Names) != len(decl.Values) {
+			return false
+		}
+		for i, name := range decl.Names {
+			if name.Name == ident.Name {
+				return isProviderLit(decl.Values[i], schemaName)
+			}
+		}
+	case *ast.Field:
+		star, ok := decl.Type.(*ast.StarExpr)
+		return ok && isQualified(star.X, schemaName, "Provider")
+	}
+	return false
+}
+
+// isProviderLit reports whether expr is &schema.Provider{...}.
+func isProviderLit(expr ast.Expr, schemaName string) bool {
+	unary, ok := expr.(*ast.UnaryExpr)
+	if !ok || unary.Op != token.AND {
+		return false
+	}
+	lit, ok := unary.X.(*ast.CompositeLit)
+	return ok && isQualified(lit.Type, schemaName, "Provider")
+}
@@ -0,0 +1,333 @@
+package v2upgrade
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+)
+
+// crudFields maps the CRUD fields of schema.Resource to their
+// context-aware variants.
+var crudFields = map[string]string{
+	"Create": "CreateContext",
+	"Read":   "ReadContext",
+	"Update": "UpdateContext",
+	"Delete": "DeleteContext",
+}
+
+// crudFunc is a function set as a CRUD field of a schema.Resource
+// literal: a function declared in the package, or a function literal.
+type crudFunc struct {
+	// name is the name of the declared function, or describes the
+	// function literal.
+	name string
+	file *codemodFile
+	pos  token.Pos
+	typ  *ast.FuncType
+	body *ast.BlockStmt
+
+	// sites are the fields set to the function.
+	sites []*crudSite
+
+	// callers are the CRUD functions returning the result of a call to
+	// this one, which is converted along with them.
+	callers []*crudFunc
+
+	// ctxDecls are the statements declaring ctx as context.Background()
+	// or context.TODO(), which the ctx parameter replaces.
+	ctxDecls []ast.Stmt
+
+	// issue is set if the function cannot be converted.
+	issue *codemodIssue
+}
+
+// crudSite is a CRUD field of a schema.Resource literal.
+type crudSite struct {
+	field *ast.KeyValueExpr
+	file  *codemodFile
+}
+
+// convertCRUDFuncs rewrites the Create, Read, Update and Delete fields
+// of schema.Resource literals to CreateContext, ReadContext,
+// UpdateContext and DeleteContext, and the functions they are set to
+// from func(*schema.ResourceData, interface{}) error to
+// func(context.Context, *schema.ResourceData, interface{}) diag.Diagnostics.
+// Returned errors are wrapped with diag.FromErr, or diag.Errorf for
+// fmt.Errorf, and calls to other CRUD functions in return statements
+// pass ctx on.
+//
+// A function is only converted if every reference to it can be
+// converted along with it, otherwise it is reported.
+func convertCRUDFuncs(pkg *codemodPackage) (int, []*codemodIssue) {
+	var issues []*codemodIssue
+
+	decls := packageFuncs(pkg)
+
+	// find the CRUD fields of schema.Resource literals
+	named := make(map[string]*crudFunc)
+	var funcs []*crudFunc
+	sites := make(map[*ast.Ident]bool)
+	for _, file := range pkg.files {
+		schemaName := util.ImportName(file.ast, schemaPackagePath)
+		if schemaName == "" {
+			continue
+		}
+
+		ast.Inspect(file.ast, func(n ast.Node) bool {
+			lit, ok := n.(*ast.CompositeLit)
+			if !ok || !isQualified(lit.Type, schemaName, "Resource") {
+				return true
+			}
+
+			fields := make(map[string]bool)
+			for _, elt := range lit.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok {
+						fields[key.Name] = true
+					}
+				}
+			}
+
+			for _, elt := range lit.Elts {
+				kv, ok := elt.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				key, ok := kv.Key.(*ast.Ident)
+				if !ok || crudFields[key.Name] == "" {
+					continue
+				}
+				if fields[crudFields[key.Name]] {
+					issues = append(issues, pkg.issue(key.Pos(), "the %s field is set along with %s", key.Name, crudFields[key.Name]))
+					continue
+				}
+
+				switch v := kv.Value.(type) {
+				case *ast.Ident:
+					d, ok := decls[v.Name]
+					if !ok || v.Obj != nil && v.Obj.Kind != ast.Fun {
+						issues = append(issues, pkg.issue(v.Pos(), "the %s field is not set to a function declared in this package", key.Name))
+						continue
+					}
+					fn, ok := named[v.Name]
+					if !ok {
+						fn = &crudFunc{
+							name: v.Name,
+							file: d.file,
+							pos:  d.decl.Pos(),
+							typ:  d.decl.Type,
+							body: d.decl.Body,
+						}
+						named[v.Name] = fn
+						funcs = append(funcs, fn)
+					}
+					fn.sites = append(fn.sites, &crudSite{kv, file})
+					sites[v] = true
+				case *ast.FuncLit:
+					funcs = append(funcs, &crudFunc{
+						name:  fmt.Sprintf("the function literal of the %s field", key.Name),
+						file:  file,
+						pos:   v.Pos(),
+						typ:   v.Type,
+						body:  v.Body,
+						sites: []*crudSite{{kv, file}},
+					})
+				default:
+					issues = append(issues, pkg.issue(v.Pos(), "the %s field is not set to a function declared in this package", key.Name))
+				}
+			}
+			return true
+		})
+	}
+	if len(funcs) == 0 {
+		return 0, issues
+	}
+
+	bodies := make(map[*ast.BlockStmt]*crudFunc)
+	for _, fn := range funcs {
+		bodies[fn.body] = fn
+		checkCRUDFunc(pkg, fn)
+	}
+
+	// every other reference to a declared CRUD function must be a call
+	// returned by another CRUD function
+	tailCalls := make(map[*ast.CallExpr]*crudFunc)
+	for _, file := range pkg.files {
+		var stack []ast.Node
+		ast.Inspect(file.ast, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			defer func() { stack = append(stack, n) }()
+
+			ident, ok := n.(*ast.Ident)
+			if !ok || sites[ident] {
+				return true
+			}
+			fn, ok := named[ident.Name]
+			if !ok || isDeclaration(ident, stack) {
+				return true
+			}
+
+			if call, caller := tailCall(ident, stack, bodies); caller != nil {
+				tailCalls[call] = fn
+				fn.callers = append(fn.callers, caller)
+				return true
+			}
+			if fn.issue == nil {
+				fn.issue = pkg.issue(fn.pos, "%s is also used in %s, which cannot be converted", fn.name, pkg.describeReference(ident))
+			}
+			return true
+		})
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, fn := range funcs {
+			if fn.issue != nil {
+				continue
+			}
+			for _, caller := range fn.callers {
+				if caller.issue != nil {
+					fn.issue = pkg.issue(fn.pos, "%s is also called by %s, which cannot be converted", fn.name, caller.name)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	converted := 0
+	convertedFiles := make(map[*codemodFile]bool)
+	for _, fn := range funcs {
+		if fn.issue != nil {
+			issues = append(issues, fn.issue)
+			continue
+		}
+		convertCRUDFunc(pkg, fn, tailCalls)
+		convertedFiles[fn.file] = true
+		converted++
+	}
+	// fmt.Errorf calls were rewritten to diag.Errorf
+	for file := range convertedFiles {
+		util.DeleteUnusedImport(pkg.fset, file.ast, "fmt")
+	}
+
+	sortIssues(issues)
+	return converted, issues
+}
+
+// checkCRUDFunc sets fn.issue if fn does not have the signature of a
+// CRUD function or declares its own ctx.
+func checkCRUDFunc(pkg *codemodPackage, fn *crudFunc) {
+	schemaName := util.ImportName(fn.file.ast, schemaPackagePath)
+	if !isCRUDSignature(fn.typ, schemaName) {
+		fn.issue = pkg.issue(fn.pos, "%s does not have the signature func(*schema.ResourceData, interface{}) error", fn.name)
+		return
+	}
+	ctxDecls, pos, ok := findCtxDecls(fn.file.ast, fn.typ, fn.body)
+	if !ok {
+		fn.issue = pkg.issue(pos, "%s declares its own ctx", fn.name)
+		return
+	}
+	fn.ctxDecls = ctxDecls
+}
+
+// convertCRUDFunc rewrites fn, its fields and the calls returned by it.
+func convertCRUDFunc(pkg *codemodPackage, fn *crudFunc, tailCalls map[*ast.CallExpr]*crudFunc) {
+	f := fn.file.ast
+	contextName := util.AddImport(pkg.fset, f, contextPackagePath)
+	diagName := util.AddImport(pkg.fset, f, diagPackagePath)
+	fmtName := util.ImportName(f, "fmt")
+	fn.file.modified = true
+
+	for _, site := range fn.sites {
+		key := site.field.Key.(*ast.Ident)
+		site.field.Key = &ast.Ident{NamePos: key.NamePos, Name: crudFields[key.Name]}
+		site.file.modified = true
+	}
+
+	addCtxParam(pkg, contextName, fn.typ, fn.body, fn.ctxDecls)
+	fn.typ.Results.List[0].Type = qualified(diagName, "Diagnostics", fn.typ.Results.List[0].Type.Pos())
+
+	ast.Inspect(fn.body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			if len(n.Results) == 1 {
+				n.Results[0] = diagnosticsResult(n.Results[0], diagName, fmtName, tailCalls)
+			}
+		}
+		return true
+	})
+}
+
+// diagnosticsResult converts the error returned by a CRUD function to
+// diag.Diagnostics.
+func diagnosticsResult(result ast.Expr, diagName, fmtName string, tailCalls map[*ast.CallExpr]*crudFunc) ast.Expr {
+	if call, ok := result.(*ast.CallExpr); ok {
+		if callee, ok := tailCalls[call]; ok && callee.issue == nil {
+			call.Args = append([]ast.Expr{ast.NewIdent("ctx")}, call.Args...)
+			return call
+		}
+	}
+	return errorDiagnostics(result, diagName, fmtName)
+}
+
+// isCRUDSignature reports whether typ is
+// func(*schema.ResourceData, interface{}) error.
+func isCRUDSignature(typ *ast.FuncType, schemaName string) bool {
+	if schemaName == "" || typ.Params == nil || len(typ.Params.List) != 2 {
+		return false
+	}
+	for _, param := range typ.Params.List {
+		if len(param.Names) > 1 {
+			return false
+		}
+	}
+	star, ok := typ.Params.List[0].Type.(*ast.StarExpr)
+	if !ok || !isQualified(star.X, schemaName, "ResourceData") {
+		return false
+	}
+	iface, ok := typ.Params.List[1].Type.(*ast.InterfaceType)
+	if !ok || len(iface.Methods.List) != 0 {
+		return false
+	}
+
+	if typ.Results == nil || len(typ.Results.List) != 1 || len(typ.Results.List[0].Names) != 0 {
+		return false
+	}
+	result, ok := typ.Results.List[0].Type.(*ast.Ident)
+	return ok && result.Name == "error"
+}
+
+// tailCall returns the call ident is the function of, and the CRUD
+// function directly enclosing it, if the call with two arguments is
+// returned by that CRUD function.
+func tailCall(ident *ast.Ident, stack []ast.Node, bodies map[*ast.BlockStmt]*crudFunc) (*ast.CallExpr, *crudFunc) {
+	if len(stack) < 2 {
+		return nil, nil
+	}
+	call, ok := stack[len(stack)-1].(*ast.CallExpr)
+	if !ok || call.Fun != ident || len(call.Args) != 2 {
+		return nil, nil
+	}
+	ret, ok := stack[len(stack)-2].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 || ret.Results[0] != call {
+		return nil, nil
+	}
+
+	for i := len(stack) - 3; i >= 0; i-- {
+		switch n := stack[i].(type) {
+		case *ast.FuncDecl:
+			return call, bodies[n.Body]
+		case *ast.FuncLit:
+			return call, bodies[n.Body]
+		}
+	}
+	return nil, nil
+}
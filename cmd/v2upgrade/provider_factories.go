@@ -0,0 +1,512 @@
+package v2upgrade
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+)
+
+const (
+	resourcePackagePath  = newPackagePath + "/helper/resource"
+	terraformPackagePath = newPackagePath + "/terraform"
+)
+
+// providerMap is a package-level map[string]terraform.ResourceProvider
+// variable, such as testAccProviders.
+type providerMap struct {
+	name string
+	spec *ast.ValueSpec
+	file *codemodFile
+
+	// idents are the declaration of the map and every reference to it.
+	idents []*ast.Ident
+
+	// lits are the map literals assigned to the variable.
+	lits []*providerMapLit
+
+	// fields are the Providers fields of resource.TestCase literals set
+	// to the map.
+	fields []*ast.Ident
+
+	// providerAsserts are expressions such as
+	// testAccProviders["example"].(*schema.Provider), with their parent.
+	providerAsserts []*providerAssert
+
+	issue *codemodIssue
+}
+
+type providerMapLit struct {
+	lit  *ast.CompositeLit
+	file *codemodFile
+}
+
+type providerAssert struct {
+	expr   *ast.TypeAssertExpr
+	key    string
+	parent ast.Node
+}
+
+// convertProviderFactories converts package-level
+// map[string]terraform.ResourceProvider variables, such as
+// testAccProviders, to map[string]func() (*schema.Provider, error)
+// variables named ProviderFactories instead of Providers, e.g.
+// testAccProviderFactories, and the Providers field of resource.TestCase
+// literals to ProviderFactories. The factories return the provider the
+// map held, so that testAccProvider.Meta() keeps returning the meta of
+// the provider configured by the test. Expressions such as
+// testAccProviders["example"].(*schema.Provider) are replaced with the
+// provider variable the map holds for the key.
+//
+// A map is only converted if every reference to it is one of these, or
+// the assignment of a map literal, otherwise it is reported.
+func convertProviderFactories(pkg *codemodPackage) (int, []*codemodIssue) {
+	var issues []*codemodIssue
+	vars := packageVars(pkg)
+
+	maps := make(map[string]*providerMap)
+	var mapList []*providerMap
+	for name, v := range vars {
+		terraformName := util.ImportName(v.file.ast, terraformPackagePath)
+		m := &providerMap{name: name, spec: v.spec, file: v.file}
+		switch {
+		case v.spec.Type != nil:
+			if !isProviderMapType(v.spec.Type, terraformName) {
+				continue
+			}
+		case len(v.spec.Names) == 1 && len(v.spec.Values) == 1:
+			lit, ok := v.spec.Values[0].(*ast.CompositeLit)
+			if !ok || !isProviderMapType(lit.Type, terraformName) {
+				continue
+			}
+			m.lits = append(m.lits, &providerMapLit{lit, v.file})
+		default:
+			continue
+		}
+		maps[name] = m
+		mapList = append(mapList, m)
+	}
+	sortProviderMaps(mapList)
+
+	// classify every reference to the maps, and find the Providers
+	// fields of test cases
+	type inlineLit struct {
+		field *ast.Ident
+		lit   *ast.CompositeLit
+		file  *codemodFile
+	}
+	var inlineLits []*inlineLit
+	for _, file := range pkg.files {
+		terraformName := util.ImportName(file.ast, terraformPackagePath)
+		resourceName := util.ImportName(file.ast, resourcePackagePath)
+
+		var stack []ast.Node
+		ast.Inspect(file.ast, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			defer func() { stack = append(stack, n) }()
+
+			if lit, ok := n.(*ast.CompositeLit); ok && resourceName != "" && isQualified(lit.Type, resourceName, "TestCase") {
+				field, value := testCaseProviders(lit)
+				if field == nil {
+					return true
+				}
+				switch value := value.(type) {
+				case *ast.Ident:
+					if m, ok := maps[value.Name]; ok {
+						m.fields = append(m.fields, field)
+						return true
+					}
+				case *ast.CompositeLit:
+					if isProviderMapType(value.Type, terraformName) {
+						inlineLits = append(inlineLits, &inlineLit{field, value, file})
+						return true
+					}
+				}
+				issues = append(issues, pkg.issue(field.Pos(), "the Providers field of resource.TestCase is not set to a map of providers declared in this package"))
+				return true
+			}
+
+			ident, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			m, ok := maps[ident.Name]
+			if !ok || ident.Obj != nil && ident.Obj.Decl != m.spec || isDeclaration(ident, stack) && !isMapDeclaration(ident, stack) {
+				return true
+			}
+			if sel, ok := stack[len(stack)-1].(*ast.SelectorExpr); ok && sel.Sel == ident {
+				return true
+			}
+			m.idents = append(m.idents, ident)
+			if m.issue != nil || isMapDeclaration(ident, stack) {
+				return true
+			}
+
+			parent := stack[len(stack)-1]
+			switch parent := parent.(type) {
+			case *ast.KeyValueExpr:
+				// the Providers field of a test case, see above
+				if parent.Value == ident && len(stack) > 1 {
+					if lit, ok := stack[len(stack)-2].(*ast.CompositeLit); ok && isQualified(lit.Type, resourceName, "TestCase") {
+						return true
+					}
+				}
+			case *ast.AssignStmt:
+				if parent.Tok == token.ASSIGN && len(parent.Lhs) == 1 && len(parent.Rhs) == 1 && parent.Lhs[0] == ident {
+					if lit, ok := parent.Rhs[0].(*ast.CompositeLit); ok && isProviderMapType(lit.Type, terraformName) {
+						m.lits = append(m.lits, &providerMapLit{lit, file})
+						return true
+					}
+				}
+			case *ast.IndexExpr:
+				if assert := providerMapAssert(parent, stack, util.ImportName(file.ast, schemaPackagePath)); assert != nil {
+					m.providerAsserts = append(m.providerAsserts, assert)
+					return true
+				}
+			}
+			m.issue = pkg.issue(m.spec.Pos(), "%s is also used in %s, which cannot be converted", m.name, pkg.describeReference(ident))
+			return true
+		})
+	}
+
+	for _, m := range mapList {
+		if m.issue == nil {
+			m.issue = checkProviderMap(pkg, m, vars)
+		}
+	}
+
+	converted := 0
+	for _, m := range mapList {
+		if m.issue != nil {
+			issues = append(issues, m.issue)
+			continue
+		}
+		issues = append(issues, convertProviderMap(pkg, m, vars)...)
+		converted++
+	}
+	for _, inline := range inlineLits {
+		if issue := checkProviderMapLit(pkg, inline.lit, inline.file, vars); issue != nil {
+			issues = append(issues, issue)
+			continue
+		}
+		convertProviderMapLit(pkg, inline.lit, inline.file, vars)
+		inline.field.Name = "ProviderFactories"
+		inline.file.modified = true
+		deleteTerraformImport(pkg, inline.file)
+		converted++
+	}
+
+	sortIssues(issues)
+	return converted, issues
+}
+
+// checkProviderMap returns an issue if the map m, its literals or its
+// test cases cannot be converted.
+func checkProviderMap(pkg *codemodPackage, m *providerMap, vars map[string]*packageVar) *codemodIssue {
+	if len(m.spec.Names) != 1 || m.spec.Type != nil && len(m.spec.Values) > 0 {
+		return pkg.issue(m.spec.Pos(), "%s is not declared on its own", m.name)
+	}
+	for _, ml := range m.lits {
+		if issue := checkProviderMapLit(pkg, ml.lit, ml.file, vars); issue != nil {
+			return issue
+		}
+	}
+	for _, assert := range m.providerAsserts {
+		if providerVarFor(m, assert.key) == nil {
+			return pkg.issue(assert.expr.Pos(), "%s does not hold a provider variable for %q", m.name, assert.key)
+		}
+	}
+	return nil
+}
+
+// checkProviderMapLit returns an issue if an element of the map literal
+// lit is not a provider, see providerValue.
+func checkProviderMapLit(pkg *codemodPackage, lit *ast.CompositeLit, file *codemodFile, vars map[string]*packageVar) *codemodIssue {
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return pkg.issue(elt.Pos(), "the element of the map of providers has no key")
+		}
+		if providerValue(pkg, file, kv.Value, vars) == nil {
+			return pkg.issue(kv.Value.Pos(), "the provider in the map of providers is not a *schema.Provider")
+		}
+	}
+	return nil
+}
+
+// convertProviderMap converts the declaration, the literals and the
+// references of m.
+func convertProviderMap(pkg *codemodPackage, m *providerMap, vars map[string]*packageVar) []*codemodIssue {
+	var issues []*codemodIssue
+
+	newName := m.name
+	if strings.Contains(m.name, "Providers") {
+		newName = strings.Replace(m.name, "Providers", "ProviderFactories", 1)
+		if _, ok := vars[newName]; ok || packageFuncs(pkg)[newName] != nil {
+			newName = m.name
+		}
+	}
+
+	// providerAsserts look up the variables in the literals, so they are
+	// replaced before the literals are converted
+	for _, assert := range m.providerAsserts {
+		provider := providerVarFor(m, assert.key)
+		if !replaceExpr(assert.parent, assert.expr, &ast.Ident{NamePos: assert.expr.Pos(), Name: provider.Name}) {
+			issues = append(issues, pkg.issue(assert.expr.Pos(), "%s[%q] could not be replaced with %s", m.name, assert.key, provider.Name))
+		}
+	}
+
+	if m.spec.Type != nil {
+		schemaName := util.AddImport(pkg.fset, m.file.ast, schemaPackagePath)
+		m.spec.Type = providerFactoriesType(schemaName, m.spec.Type.Pos())
+		m.file.modified = true
+	}
+	for _, ml := range m.lits {
+		convertProviderMapLit(pkg, ml.lit, ml.file, vars)
+	}
+	for _, field := range m.fields {
+		field.Name = "ProviderFactories"
+	}
+	for _, ident := range m.idents {
+		ident.Name = newName
+	}
+
+	// the map may be referenced in any file of the package
+	for _, file := range pkg.files {
+		for _, ident := range m.idents {
+			if ident.Pos() >= file.ast.Pos() && ident.End() <= file.ast.End() {
+				file.modified = true
+				break
+			}
+		}
+		if file.modified {
+			deleteTerraformImport(pkg, file)
+		}
+	}
+	return issues
+}
+
+// convertProviderMapLit converts the map[string]terraform.ResourceProvider
+// literal lit to a map of provider factories, each returning the
+// provider of its element.
+func convertProviderMapLit(pkg *codemodPackage, lit *ast.CompositeLit, file *codemodFile, vars map[string]*packageVar) {
+	schemaName := util.AddImport(pkg.fset, file.ast, schemaPackagePath)
+	lit.Type = providerFactoriesType(schemaName, lit.Type.Pos())
+	for _, elt := range lit.Elts {
+		kv := elt.(*ast.KeyValueExpr)
+		provider := providerValue(pkg, file, kv.Value, vars)
+		pos := kv.Value.Pos()
+		kv.Value = &ast.FuncLit{
+			Type: providerFactoryType(schemaName, pos),
+			Body: &ast.BlockStmt{
+				Lbrace: pos,
+				List: []ast.Stmt{&ast.ReturnStmt{
+					Return:  pos,
+					Results: []ast.Expr{provider, &ast.Ident{NamePos: pos, Name: "nil"}},
+				}},
+				Rbrace: pos,
+			},
+		}
+	}
+	file.modified = true
+}
+
+// providerValue returns expr as a *schema.Provider: a variable of that
+// type, a type assertion to it, or a call of a function declared in the
+// package returning it. A call of a function returning a
+// terraform.ResourceProvider is asserted to *schema.Provider. It returns
+// nil for other expressions.
+func providerValue(pkg *codemodPackage, file *codemodFile, expr ast.Expr, vars map[string]*packageVar) ast.Expr {
+	schemaName := util.ImportName(file.ast, schemaPackagePath)
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if e.Obj != nil && e.Obj.Kind == ast.Var {
+			if isProviderVar(e, schemaName) {
+				return expr
+			}
+			return nil
+		}
+		if v, ok := vars[e.Name]; ok && isProviderPointer(v.spec.Type, util.ImportName(v.file.ast, schemaPackagePath)) {
+			return expr
+		}
+	case *ast.TypeAssertExpr:
+		if isProviderPointer(e.Type, schemaName) {
+			return expr
+		}
+	case *ast.CallExpr:
+		ident, ok := e.Fun.(*ast.Ident)
+		if !ok || len(e.Args) != 0 {
+			return nil
+		}
+		d, ok := packageFuncs(pkg)[ident.Name]
+		if !ok || d.decl.Type.Results == nil || len(d.decl.Type.Results.List) != 1 {
+			return nil
+		}
+		result := d.decl.Type.Results.List[0].Type
+		if isProviderPointer(result, util.ImportName(d.file.ast, schemaPackagePath)) {
+			return expr
+		}
+		if isQualified(result, util.ImportName(d.file.ast, terraformPackagePath), "ResourceProvider") {
+			name := util.AddImport(pkg.fset, file.ast, schemaPackagePath)
+			return &ast.TypeAssertExpr{
+				X:      expr,
+				Lparen: expr.End(),
+				Type:   &ast.StarExpr{Star: expr.End(), X: qualified(name, "Provider", expr.End())},
+				Rparen: expr.End(),
+			}
+		}
+	}
+	return nil
+}
+
+// providerVarFor returns the provider variable m holds for key in its
+// literals, or nil if it does not hold one.
+func providerVarFor(m *providerMap, key string) *ast.Ident {
+	var provider *ast.Ident
+	for _, ml := range m.lits {
+		for _, elt := range ml.lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			k, ok := kv.Key.(*ast.BasicLit)
+			if !ok || k.Kind != token.STRING {
+				continue
+			}
+			if s, err := strconv.Unquote(k.Value); err != nil || s != key {
+				continue
+			}
+			ident, ok := kv.Value.(*ast.Ident)
+			if !ok || provider != nil && provider.Name != ident.Name {
+				return nil
+			}
+			provider = ident
+		}
+	}
+	return provider
+}
+
+// providerMapAssert returns the type assertion of the map index index to
+// *schema.Provider, with a string literal key, if index is asserted.
+func providerMapAssert(index *ast.IndexExpr, stack []ast.Node, schemaName string) *providerAssert {
+	if len(stack) < 3 {
+		return nil
+	}
+	assert, ok := stack[len(stack)-2].(*ast.TypeAssertExpr)
+	if !ok || assert.X != index || !isProviderPointer(assert.Type, schemaName) {
+		return nil
+	}
+	key, ok := index.Index.(*ast.BasicLit)
+	if !ok || key.Kind != token.STRING {
+		return nil
+	}
+	s, err := strconv.Unquote(key.Value)
+	if err != nil {
+		return nil
+	}
+	return &providerAssert{expr: assert, key: s, parent: stack[len(stack)-3]}
+}
+
+// sortProviderMaps sorts maps by the position of their declaration.
+func sortProviderMaps(maps []*providerMap) {
+	sort.Slice(maps, func(i, j int) bool {
+		return maps[i].spec.Pos() < maps[j].spec.Pos()
+	})
+}
+
+// testCaseProviders returns the key and value of the Providers field of
+// the resource.TestCase literal lit, unless it is not set or
+// ProviderFactories is set too.
+func testCaseProviders(lit *ast.CompositeLit) (*ast.Ident, ast.Expr) {
+	var field *ast.Ident
+	var value ast.Expr
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		switch key.Name {
+		case "Providers":
+			field, value = key, kv.Value
+		case "ProviderFactories":
+			return nil, nil
+		}
+	}
+	return field, value
+}
+
+// deleteTerraformImport removes the import of the terraform package
+// from file if the conversion left it unused.
+func deleteTerraformImport(pkg *codemodPackage, file *codemodFile) {
+	util.DeleteUnusedImport(pkg.fset, file.ast, terraformPackagePath)
+}
+
+// isMapDeclaration reports whether ident is the name in the declaration
+// of a variable.
+func isMapDeclaration(ident *ast.Ident, stack []ast.Node) bool {
+	if len(stack) == 0 {
+		return false
+	}
+	spec, ok := stack[len(stack)-1].(*ast.ValueSpec)
+	if !ok {
+		return false
+	}
+	for _, name := range spec.Names {
+		if name == ident {
+			return true
+		}
+	}
+	return false
+}
+
+// isProviderMapType reports whether expr is
+// map[string]terraform.ResourceProvider.
+func isProviderMapType(expr ast.Expr, terraformName string) bool {
+	mapType, ok := expr.(*ast.MapType)
+	if !ok || terraformName == "" {
+		return false
+	}
+	key, ok := mapType.Key.(*ast.Ident)
+	return ok && key.Name == "string" && isQualified(mapType.Value, terraformName, "ResourceProvider")
+}
+
+// isProviderPointer reports whether expr is *schema.Provider.
+func isProviderPointer(expr ast.Expr, schemaName string) bool {
+	star, ok := expr.(*ast.StarExpr)
+	return ok && schemaName != "" && isQualified(star.X, schemaName, "Provider")
+}
+
+// providerFactoriesType returns map[string]func() (*schema.Provider, error).
+func providerFactoriesType(schemaName string, pos token.Pos) *ast.MapType {
+	return &ast.MapType{
+		Map:   pos,
+		Key:   &ast.Ident{NamePos: pos, Name: "string"},
+		Value: providerFactoryType(schemaName, pos),
+	}
+}
+
+// providerFactoryType returns func() (*schema.Provider, error).
+func providerFactoryType(schemaName string, pos token.Pos) *ast.FuncType {
+	return &ast.FuncType{
+		Func:   pos,
+		Params: &ast.FieldList{Opening: pos, Closing: pos},
+		Results: &ast.FieldList{
+			Opening: pos,
+			List: []*ast.Field{
+				{Type: &ast.StarExpr{Star: pos, X: qualified(schemaName, "Provider", pos)}},
+				{Type: &ast.Ident{NamePos: pos, Name: "error"}},
+			},
+			Closing: pos,
+		},
+	}
+}
@@ -0,0 +1,266 @@
+package v2upgrade
+
+import (
+	"go/ast"
+	"sort"
+	"strconv"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+)
+
+const pluginPackagePath = newPackagePath + "/plugin"
+
+// convertProviderFuncs rewrites the result type of functions returning a
+// terraform.ResourceProvider, such as func Provider(), to
+// *schema.Provider, which SDK v2 requires, if every provider they return
+// is a *schema.Provider. Type assertions of their results to
+// *schema.Provider, which are then redundant, are removed, in every
+// package of the provider. The ProviderFunc literals of plugin.ServeOpts
+// return a *schema.Provider too.
+//
+// Functions and ProviderFunc literals which may return another
+// terraform.ResourceProvider are reported.
+func convertProviderFuncs(pkg *codemodPackage) (int, []*codemodIssue) {
+	var issues []*codemodIssue
+
+	funcs := providerFuncs(pkg)
+	vars := packageVars(pkg)
+
+	converted := 0
+	for _, fn := range sortedPackageFuncs(packageFuncs(pkg)) {
+		result := resourceProviderResult(fn.decl.Type, fn.file.ast)
+		if result == nil {
+			continue
+		}
+		if _, ok := funcs[fn.decl.Name.Name]; !ok {
+			ret := firstNonProviderReturn(pkg, fn.file, fn.decl.Body, funcs, vars)
+			issues = append(issues, pkg.issue(ret.Pos(), "%s returns a terraform.ResourceProvider which may not be a *schema.Provider", fn.decl.Name.Name))
+			continue
+		}
+		schemaName := util.AddImport(pkg.fset, fn.file.ast, schemaPackagePath)
+		fn.decl.Type.Results.List[0].Type = &ast.StarExpr{Star: result.Pos(), X: qualified(schemaName, "Provider", result.Pos())}
+		fn.file.modified = true
+		converted++
+	}
+
+	for _, file := range pkg.files {
+		schemaName := util.ImportName(file.ast, schemaPackagePath)
+		pluginName := util.ImportName(file.ast, pluginPackagePath)
+		if schemaName == "" && pluginName == "" {
+			continue
+		}
+
+		// remove redundant type assertions
+		var stack []ast.Node
+		ast.Inspect(file.ast, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			defer func() { stack = append(stack, n) }()
+
+			assert, ok := n.(*ast.TypeAssertExpr)
+			if !ok || !isProviderPointer(assert.Type, schemaName) || !isProviderFuncCall(pkg, file, assert.X, funcs) {
+				return true
+			}
+			if !replaceExpr(stack[len(stack)-1], assert, assert.X) {
+				issues = append(issues, pkg.issue(assert.Pos(), "the redundant type assertion to *schema.Provider could not be removed"))
+				return true
+			}
+			file.modified = true
+			return true
+		})
+
+		// convert the ProviderFunc of plugin.ServeOpts
+		ast.Inspect(file.ast, func(n ast.Node) bool {
+			lit, ok := n.(*ast.CompositeLit)
+			if !ok || pluginName == "" || !isQualified(lit.Type, pluginName, "ServeOpts") {
+				return true
+			}
+			for _, elt := range lit.Elts {
+				kv, ok := elt.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				key, ok := kv.Key.(*ast.Ident)
+				if !ok || key.Name != "ProviderFunc" {
+					continue
+				}
+				fn, ok := kv.Value.(*ast.FuncLit)
+				if !ok {
+					continue
+				}
+				result := resourceProviderResult(fn.Type, file.ast)
+				if result == nil {
+					continue
+				}
+				if ret := firstNonProviderReturn(pkg, file, fn.Body, funcs, vars); ret != nil {
+					issues = append(issues, pkg.issue(ret.Pos(), "the ProviderFunc of plugin.ServeOpts returns a terraform.ResourceProvider which may not be a *schema.Provider"))
+					continue
+				}
+				name := util.AddImport(pkg.fset, file.ast, schemaPackagePath)
+				fn.Type.Results.List[0].Type = &ast.StarExpr{Star: result.Pos(), X: qualified(name, "Provider", result.Pos())}
+				file.modified = true
+				converted++
+			}
+			return true
+		})
+
+		if file.modified {
+			util.DeleteUnusedImport(pkg.fset, file.ast, terraformPackagePath)
+		}
+	}
+
+	sortIssues(issues)
+	return converted, issues
+}
+
+// providerFuncs returns the functions declared in pkg which return a
+// *schema.Provider, or a terraform.ResourceProvider which is always a
+// *schema.Provider, by name.
+func providerFuncs(pkg *codemodPackage) map[string]*packageFunc {
+	decls := packageFuncs(pkg)
+	vars := packageVars(pkg)
+
+	funcs := make(map[string]*packageFunc)
+	for name, fn := range decls {
+		typ := fn.decl.Type
+		if typ.Results == nil || len(typ.Results.List) != 1 || len(typ.Results.List[0].Names) > 1 {
+			continue
+		}
+		if isProviderPointer(typ.Results.List[0].Type, util.ImportName(fn.file.ast, schemaPackagePath)) || resourceProviderResult(typ, fn.file.ast) != nil {
+			funcs[name] = fn
+		}
+	}
+
+	// functions returning the results of each other are only kept while
+	// all of their returns are providers
+	for changed := true; changed; {
+		changed = false
+		for name, fn := range funcs {
+			if resourceProviderResult(fn.decl.Type, fn.file.ast) == nil {
+				continue
+			}
+			if firstNonProviderReturn(pkg, fn.file, fn.decl.Body, funcs, vars) != nil {
+				delete(funcs, name)
+				changed = true
+			}
+		}
+	}
+	return funcs
+}
+
+// firstNonProviderReturn returns the first result returned in body
+// which is not known to be a *schema.Provider, see isSchemaProvider, or
+// nil if there is none.
+func firstNonProviderReturn(pkg *codemodPackage, file *codemodFile, body *ast.BlockStmt, funcs map[string]*packageFunc, vars map[string]*packageVar) ast.Node {
+	var found ast.Node
+	ast.Inspect(body, func(n ast.Node) bool {
+		if found != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			if len(n.Results) != 1 {
+				found = n
+			} else if !isSchemaProvider(pkg, file, n.Results[0], funcs, vars) {
+				found = n.Results[0]
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// isSchemaProvider reports whether expr is known to be a
+// *schema.Provider: &schema.Provider{...}, a variable of that type, a
+// type assertion to it, or a call of a function returning it.
+func isSchemaProvider(pkg *codemodPackage, file *codemodFile, expr ast.Expr, funcs map[string]*packageFunc, vars map[string]*packageVar) bool {
+	schemaName := util.ImportName(file.ast, schemaPackagePath)
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return isSchemaProvider(pkg, file, e.X, funcs, vars)
+	case *ast.UnaryExpr:
+		return isProviderLit(e, schemaName)
+	case *ast.Ident:
+		if e.Obj != nil {
+			return isProviderVar(e, schemaName)
+		}
+		v, ok := vars[e.Name]
+		return ok && isProviderPointer(v.spec.Type, util.ImportName(v.file.ast, schemaPackagePath))
+	case *ast.TypeAssertExpr:
+		return isProviderPointer(e.Type, schemaName)
+	case *ast.CallExpr:
+		return isProviderFuncCall(pkg, file, e, funcs)
+	}
+	return false
+}
+
+// isProviderFuncCall reports whether expr is a call of one of funcs, or
+// of a function returning a *schema.Provider in another package of the
+// provider.
+func isProviderFuncCall(pkg *codemodPackage, file *codemodFile, expr ast.Expr, funcs map[string]*packageFunc) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		_, ok := funcs[fun.Name]
+		return ok && (fun.Obj == nil || fun.Obj.Kind == ast.Fun)
+	case *ast.SelectorExpr:
+		x, ok := fun.X.(*ast.Ident)
+		if !ok || x.Obj != nil {
+			return false
+		}
+		other := pkg.packages[importPathOf(file.ast, x.Name)]
+		if other == nil || other == pkg {
+			return false
+		}
+		_, ok = providerFuncs(other)[fun.Sel.Name]
+		return ok
+	}
+	return false
+}
+
+// resourceProviderResult returns the result type of typ if it is
+// terraform.ResourceProvider.
+func resourceProviderResult(typ *ast.FuncType, f *ast.File) ast.Expr {
+	if typ.Results == nil || len(typ.Results.List) != 1 || len(typ.Results.List[0].Names) > 1 {
+		return nil
+	}
+	result := typ.Results.List[0].Type
+	if !isQualified(result, util.ImportName(f, terraformPackagePath), "ResourceProvider") {
+		return nil
+	}
+	return result
+}
+
+// importPathOf returns the path of the package imported as name in f, or
+// an empty string if there is none.
+func importPathOf(f *ast.File, name string) string {
+	for _, spec := range f.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if util.ImportName(f, importPath) == name {
+			return importPath
+		}
+	}
+	return ""
+}
+
+// sortedPackageFuncs returns funcs sorted by position.
+func sortedPackageFuncs(funcs map[string]*packageFunc) []*packageFunc {
+	sorted := make([]*packageFunc, 0, len(funcs))
+	for _, fn := range funcs {
+		sorted = append(sorted, fn)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].decl.Pos() < sorted[j].decl.Pos()
+	})
+	return sorted
+}
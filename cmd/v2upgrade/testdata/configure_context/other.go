@@ -0,0 +1,53 @@
+package example
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func OtherProvider() *schema.Provider {
+	return &schema.Provider{
+		ConfigureFunc: otherConfigure,
+	}
+}
+
+func otherConfigure(d *schema.ResourceData) (interface{}, error) {
+	ctx := context.Background()
+	if err := ping(ctx); err != nil {
+		return nil, fmt.Errorf("pinging: %s", err)
+	}
+	return Config{Endpoint: "other"}, nil
+}
+
+func SharedProvider() *schema.Provider {
+	return &schema.Provider{
+		ConfigureFunc: sharedConfigure,
+	}
+}
+
+// configures is not a ConfigureFunc field, so sharedConfigure stays as
+// it is.
+var configures = []schema.ConfigureFunc{sharedConfigure}
+
+func sharedConfigure(d *schema.ResourceData) (interface{}, error) {
+	return nil, nil
+}
+
+func ClientProvider() *schema.Provider {
+	return &schema.Provider{
+		ConfigureFunc: clientConfigure,
+	}
+}
+
+// ctx is kept by the client, so it is not replaced with the ctx
+// parameter, which is canceled once clientConfigure returned.
+func clientConfigure(d *schema.ResourceData) (interface{}, error) {
+	ctx := context.Background()
+	if err := ping(ctx); err != nil {
+		return nil, err
+	}
+	config := Config{Endpoint: "client"}
+	return config.Client(ctx)
+}
@@ -0,0 +1,54 @@
+package example
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func Provider() *schema.Provider {
+	p := &schema.Provider{
+		Schema: map[string]*schema.Schema{
+			"endpoint": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+		},
+	}
+	p.ConfigureFunc = providerConfigure(p)
+	return p
+}
+
+func providerConfigure(p *schema.Provider) schema.ConfigureFunc {
+	return func(d *schema.ResourceData) (interface{}, error) {
+		stop := p.StopContext()
+		select {
+		case <-stop.Done():
+			return nil, stop.Err()
+		default:
+		}
+
+		if err := ping(p.StopContext()); err != nil {
+			return nil, fmt.Errorf("pinging %s: %w", d.Get("endpoint"), err)
+		}
+
+		config := Config{
+			Endpoint: d.Get("endpoint").(string),
+			Stop:     p.StopContext(),
+		}
+		go watch(p.StopContext())
+		return config.Client(p.StopContext())
+	}
+}
+
+type Config struct {
+	Endpoint string
+	Stop     context.Context
+}
+
+func (c Config) Client(ctx context.Context) (interface{}, error) { return c, nil }
+
+func ping(ctx context.Context) error { return nil }
+
+func watch(ctx context.Context) {}
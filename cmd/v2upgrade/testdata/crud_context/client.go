@@ -0,0 +1,12 @@
+package example
+
+import "context"
+
+type Client struct{}
+
+func (c *Client) Create(ctx context.Context, name string) (string, error) { return name, nil }
+func (c *Client) Read(ctx context.Context, id string) (string, error)     { return id, nil }
+func (c *Client) Update(id, name string) error                            { return nil }
+func (c *Client) Delete(id string) error                                  { return nil }
+func (c *Client) Ping(ctx context.Context) error                          { return nil }
+func (c *Client) Contexts() []context.Context                             { return nil }
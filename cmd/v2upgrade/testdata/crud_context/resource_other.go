@@ -0,0 +1,32 @@
+package example
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceOther() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceOtherCreate,
+		Read:   resourceOtherRead,
+		Delete: schema.Noop,
+	}
+}
+
+// readers is not a CRUD field, so resourceOtherRead stays as it is.
+var readers = []schema.ReadFunc{resourceOtherRead}
+
+func resourceOtherCreate(d *schema.ResourceData, meta interface{}) error {
+	for _, ctx := range meta.(*Client).Contexts() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	d.SetId("other")
+	return nil
+}
+
+func resourceOtherRead(d *schema.ResourceData, meta interface{}) error {
+	return meta.(*Client).Ping(context.Background())
+}
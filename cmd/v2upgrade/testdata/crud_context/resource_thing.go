@@ -0,0 +1,58 @@
+package example
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceThing() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceThingCreate,
+		Read:   resourceThingRead,
+		Update: resourceThingUpdate,
+		Delete: func(d *schema.ResourceData, meta interface{}) error {
+			if err := meta.(*Client).Delete(d.Id()); err != nil {
+				return fmt.Errorf("deleting thing %s: %s", d.Id(), err)
+			}
+			return nil
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+		},
+	}
+}
+
+func resourceThingCreate(d *schema.ResourceData, meta interface{}) error {
+	ctx := context.Background()
+	id, err := meta.(*Client).Create(ctx, d.Get("name").(string))
+	if err != nil {
+		return fmt.Errorf("creating thing: %w", err)
+	}
+	d.SetId(id)
+	return resourceThingRead(d, meta)
+}
+
+func resourceThingRead(d *schema.ResourceData, meta interface{}) error {
+	name, err := meta.(*Client).Read(context.TODO(), d.Id())
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("thing %s has no name", d.Id())
+	}
+	d.Set("name", name)
+	return nil
+}
+
+func resourceThingUpdate(d *schema.ResourceData, meta interface{}) error {
+	if err := meta.(*Client).Update(d.Id(), d.Get("name").(string)); err != nil {
+		return err
+	}
+	return resourceThingRead(d, meta)
+}
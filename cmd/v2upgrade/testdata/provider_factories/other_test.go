@@ -0,0 +1,30 @@
+package example
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+var testAccOtherProviders = map[string]terraform.ResourceProvider{
+	"example": Provider().(*schema.Provider),
+}
+
+// testAccMixedProviders is passed to a function, so it is reported.
+var testAccMixedProviders = map[string]terraform.ResourceProvider{
+	"example": Provider(),
+}
+
+func TestAccOther_basic(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		Providers: testAccOtherProviders,
+	})
+}
+
+func TestAccMixed_basic(t *testing.T) {
+	checkProviders(t, testAccMixedProviders)
+}
+
+func checkProviders(t *testing.T, providers map[string]terraform.ResourceProvider) {}
@@ -0,0 +1,10 @@
+package example
+
+import (
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func Provider() terraform.ResourceProvider {
+	return &schema.Provider{}
+}
@@ -0,0 +1,37 @@
+package example
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+var testAccProviders map[string]terraform.ResourceProvider
+var testAccProvider *schema.Provider
+
+func init() {
+	testAccProvider = Provider().(*schema.Provider)
+	testAccProviders = map[string]terraform.ResourceProvider{
+		"example": testAccProvider,
+	}
+}
+
+func TestAccThing_basic(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: `resource "example_thing" "test" {}`,
+			},
+		},
+	})
+}
+
+func TestProvider_meta(t *testing.T) {
+	p := testAccProviders["example"].(*schema.Provider)
+	if p.Meta() != nil {
+		t.Fatal("unexpected meta")
+	}
+}
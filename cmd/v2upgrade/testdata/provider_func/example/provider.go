@@ -0,0 +1,18 @@
+package example
+
+import (
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func Provider() terraform.ResourceProvider {
+	return &schema.Provider{
+		ResourcesMap: map[string]*schema.Resource{
+			"example_thing": resourceThing(),
+		},
+	}
+}
+
+func resourceThing() *schema.Resource {
+	return &schema.Resource{}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"example.com/terraform-provider-example/example"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func main() {
+	plugin.Serve(&plugin.ServeOpts{
+		ProviderFunc: func() terraform.ResourceProvider {
+			return example.Provider()
+		},
+	})
+}
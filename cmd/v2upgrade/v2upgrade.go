@@ -8,15 +8,19 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/hashicorp/tf-sdk-migrator/cmd/check"
 	"github.com/hashicorp/tf-sdk-migrator/util"
 	"github.com/mitchellh/cli"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 )
 
 const (
-	CommandName    = "v2upgrade"
-	oldPackagePath = "github.com/hashicorp/terraform-plugin-sdk"
-	newPackagePath = "github.com/hashicorp/terraform-plugin-sdk/v2"
-	defaultVersion = "v2.4.3"
+	CommandName     = "v2upgrade"
+	oldPackagePath  = "github.com/hashicorp/terraform-plugin-sdk"
+	newPackagePath  = "github.com/hashicorp/terraform-plugin-sdk/v2"
+	sdkMajorVersion = "v2"
+	defaultVersion  = "v2.4.3"
 )
 
 var printConfig = printer.Config{
@@ -35,19 +39,70 @@ func CommandFactory(ui cli.Ui) func() (cli.Command, error) {
 }
 
 func (c *command) Help() string {
-	return `Usage: tf-sdk-migrator v2upgrade [--help] [--sdk-version SDK_VERSION] [IMPORT_PATH]
+	return `Usage: tf-sdk-migrator v2upgrade [--help] [--sdk-version SDK_VERSION] [--force] [--fix] [--dry-run] [--offline]
+       [--replace-fork MODULE[@VERSION]] [--rules PATH]... [TOOLCHAIN FLAGS] [IMPORT_PATH]
 
   Upgrades the Terraform provider to major version 2 of the Terraform
   provider SDK, defaulting to the git reference ` + defaultVersion + `.
 
-  Rewrites import paths and go.mod. No backup is made before files are
-  overwritten.
+  Each module is checked first as by tf-sdk-migrator v2check, and is only
+  upgraded if it is ready, unless --force is passed. Additional JSON
+  rulesets describing package moves and removed packages or identifiers
+  can be loaded with --rules.
+
+  Rewrites import paths and go.mod. Every module of the repository which
+  depends on SDK v1, including go.work workspace members, is upgraded
+  with its own go.mod. Original file contents are journaled
+  first: if any step fails or the run is interrupted, every file is
+  restored, and a completed run can be undone with
+  tf-sdk-migrator rollback.
+
+  With --fix, code using SDK v1 APIs which changed in SDK v2 is converted
+  where possible, and the code which could not be converted is listed:
+
+  - Create, Read, Update and Delete functions of resources become
+    CreateContext, ReadContext, UpdateContext and DeleteContext
+    functions taking a context.Context and returning diag.Diagnostics.
+  - The ConfigureFunc of providers becomes a ConfigureContextFunc.
+  - Calls to the provider's StopContext() in it become ctx if their
+    result is only used during the call, and the stop context returned
+    by schema.StopContext(ctx), or ctx if it holds none, if it may be
+    kept. A ctx declared as context.Background() in it is replaced
+    with ctx unless it may be kept, in which case its declaration is
+    renamed.
+  - Maps of providers used by acceptance tests, such as
+    testAccProviders, become maps of provider factories set as the
+    ProviderFactories of test cases.
+  - Functions returning a terraform.ResourceProvider, such as
+    Provider(), and the ProviderFunc passed to plugin.Serve return a
+    *schema.Provider, without redundant type assertions of their results.
+  - Removed helper/validation functions with a direct replacement, such
+    as ValidateRegexp, are renamed.
+
+  Replace and exclude directives for the old SDK, which are stale once it
+  is no longer required, are removed from go.mod. With --replace-fork, the
+  new SDK is replaced with the given fork (the version defaults to latest)
+  or local directory instead of dropping a replacement of the old SDK.
+
+  With --dry-run, all changes (including the effect of go mod tidy) are
+  computed without modifying the provider and printed as a unified diff.
 
   IMPORT_PATH is resolved relative to $GOPATH/src/IMPORT_PATH. If it is not supplied,
   it is assumed that the current working directory contains a Terraform provider.
 
   Optionally, an SDK_VERSION can be passed, which is parsed as a Go module
-  release version. For example: v2.0.1, latest, master.
+  version query. For example: v2.0.1, latest, master. It is resolved to a
+  version or pseudo-version through GOPROXY before anything is changed,
+  and must be a v2 version.
+
+  The go tool is run as configured by --go-bin, --goflags, --goproxy,
+  --goprivate and --go-timeout, see the check command.
+
+  With --offline, the network is never accessed: SDK_VERSION must be a
+  version or latest, and is resolved from the module cache or file://
+  entries of GOPROXY. All required modules are checked to be available
+  before any file is modified, and go mod tidy runs with GOPROXY=off
+  (or the file:// entries) and GOFLAGS=-mod=mod.
 
 Example:
   tf-sdk-migrator v2upgrade --sdk-version v2.0.0-rc.1 github.com/terraform-providers/terraform-provider-local`
@@ -59,8 +114,21 @@ func (c *command) Synopsis() string {
 
 func (c *command) Run(args []string) int {
 	flags := flag.NewFlagSet(CommandName, flag.ExitOnError)
-	var sdkVersion string
-	flags.StringVar(&sdkVersion, "sdk-version", defaultVersion, "SDK version")
+	var sdkVersionQuery string
+	flags.StringVar(&sdkVersionQuery, "sdk-version", defaultVersion, "SDK version")
+	var dryRun bool
+	flags.BoolVar(&dryRun, "dry-run", false, "Print a diff of all changes instead of writing them")
+	var forceUpgrade bool
+	flags.BoolVar(&forceUpgrade, "force", false, "Whether to ignore failing checks and force the upgrade")
+	var fix bool
+	flags.BoolVar(&fix, "fix", false, "Convert code to SDK v2 APIs where possible")
+	var rulesPaths util.StringSliceFlag
+	flags.Var(&rulesPaths, "rules", "Ruleset file or directory to load in addition to the built-in rules")
+	tc := util.NewToolchain()
+	tc.AddFlags(flags)
+	flags.BoolVar(&tc.Offline, "offline", false, "Resolve modules from the module cache or a file:// GOPROXY only")
+	var replaceFork string
+	flags.StringVar(&replaceFork, "replace-fork", "", "Fork of the SDK to replace it with, as MODULE[@VERSION] or a local path")
 	flags.Parse(args)
 
 	var providerRepoName string
@@ -84,85 +152,245 @@ func (c *command) Run(args []string) int {
 		return cli.RunResultHelp
 	}
 
-	c.ui.Output("Rewriting provider go.mod file...")
-	err := util.RewriteGoMod(providerPath, sdkVersion, oldPackagePath, newPackagePath)
+	rules, err := check.TargetSDKv2.LoadRuleset(rulesPaths)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error loading rules: %s", err))
+		return 1
+	}
+
+	ctx, cancel := util.InterruptContext()
+	defer cancel()
+
+	// reject other major versions before looking them up
+	if semver.IsValid(sdkVersionQuery) && semver.Major(sdkVersionQuery) != sdkMajorVersion {
+		c.ui.Error(fmt.Sprintf("SDK version %s is not a %s release.", sdkVersionQuery, sdkMajorVersion))
+		return 1
+	}
+
+	c.ui.Output(fmt.Sprintf("Resolving %s@%s...", newPackagePath, sdkVersionQuery))
+	sdkVersion, err := tc.ResolveModuleVersion(ctx, newPackagePath, sdkVersionQuery)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error resolving SDK version %s: %s", sdkVersionQuery, err))
+		return 1
+	}
+	if semver.Major(sdkVersion) != sdkMajorVersion {
+		c.ui.Error(fmt.Sprintf("SDK version %s is not a %s release.", sdkVersion, sdkMajorVersion))
+		return 1
+	}
+
+	var replacement *module.Version
+	if replaceFork != "" {
+		c.ui.Output(fmt.Sprintf("Resolving %s...", replaceFork))
+		replacement, err = tc.ResolveReplacement(ctx, replaceFork)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error resolving --replace-fork %s: %s", replaceFork, err))
+			return 1
+		}
+	}
+
+	modules, err := util.FindModulesRequiring(providerPath, oldPackagePath)
 	if err != nil {
-		c.ui.Error(fmt.Sprintf("Error rewriting go.mod file: %s", err))
+		c.ui.Error(fmt.Sprintf("Error finding modules: %s", err))
 		return 1
 	}
+	if len(modules) == 0 {
+		// the provider may be a subdirectory of a larger module,
+		// otherwise RewriteGoMod reports why
+		enclosing, err := util.FindEnclosingModule(providerPath)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error finding go.mod: %s", err))
+			return 1
+		}
+		if enclosing == nil {
+			enclosing = &util.Module{Dir: providerPath}
+		}
+		modules = []*util.Module{enclosing}
+	}
+	multiModule := len(modules) > 1
+
+	cs := util.NewChangeset()
+
+	// the diff of a shared module is relative to its root, so that it
+	// includes go.mod
+	diffRoot := providerPath
+
+	for _, m := range modules {
+		// only the provider's own packages are rewritten in a module it
+		// shares with others
+		dir := m.Dir
+		shared := m.Dir != providerPath && m.Contains(providerPath)
+		if shared {
+			dir = providerPath
+			diffRoot = m.Dir
+		}
+
+		moduleName := providerRepoName
+		if multiModule {
+			moduleName = m.Path
+			c.ui.Output(fmt.Sprintf("\nModule %s in %s:", m.Path, util.RelativePath(providerPath, m.Dir)))
+		}
+
+		_, err = check.TargetSDKv2.RunCheck(ctx, c.ui, tc, dir, moduleName, rules)
+		if ctx.Err() != nil {
+			c.ui.Error("Interrupted.")
+			return 1
+		}
+		if err != nil {
+			c.ui.Warn(err.Error())
+			if forceUpgrade {
+				c.ui.Warn("Ignoring failed eligibility checks")
+			} else {
+				c.ui.Error("Provider failed eligibility check for the upgrade to SDK v2. Please see messages above.")
+				return 1
+			}
+		}
 
-	c.ui.Output("Rewriting SDK package imports...")
-	err = filepath.Walk(providerPath, func(path string, info os.FileInfo, err error) error {
+		if shared {
+			c.ui.Output(fmt.Sprintf("Rewriting go.mod file of module %s in %s...", m.Path, m.Dir))
+			err = util.RewriteSharedGoMod(cs, m.Dir, sdkVersion, oldPackagePath, newPackagePath)
+		} else {
+			c.ui.Output("Rewriting provider go.mod file...")
+			err = util.RewriteGoMod(cs, m.Dir, sdkVersion, oldPackagePath, newPackagePath)
+		}
 		if err != nil {
-			return err
+			c.ui.Error(fmt.Sprintf("Error rewriting go.mod file: %s", err))
+			return 1
 		}
-		if info.IsDir() && info.Name() == "vendor" {
-			return filepath.SkipDir
+
+		err = util.RewriteModuleDirectives(c.ui, cs, m, shared, oldPackagePath, newPackagePath, replacement, sdkVersion)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error rewriting replace and exclude directives: %s", err))
+			return 1
+		}
+
+		c.ui.Output("Rewriting SDK package imports...")
+		err = util.RewriteImports(cs, dir, rules.ImportRewrites())
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error rewriting SDK imports: %s", err))
+			return 1
 		}
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".go") {
-			err := util.RewriteImportedPackageImports(path, oldPackagePath, newPackagePath)
+
+		if fix {
+			err = c.runCodemods(cs, m, dir, providerPath)
 			if err != nil {
-				return err
+				c.ui.Error(fmt.Sprintf("Error converting code to SDK v2: %s", err))
+				return 1
 			}
 		}
-		return nil
-	})
-	if err != nil {
-		c.ui.Error(fmt.Sprintf("Error rewriting SDK imports: %s", err))
-		return 1
-	}
 
-	c.ui.Output("Running `go mod tidy`...")
-	err = util.GoModTidy(providerPath)
-	if err != nil {
-		c.ui.Error(fmt.Sprintf("Error running go mod tidy: %s", err))
-		return 1
+		if tc.Offline {
+			c.ui.Output("Checking that all required modules are available offline...")
+			missing, err := util.MissingModules(ctx, tc, cs, m.Dir)
+			if err != nil {
+				c.ui.Error(fmt.Sprintf("Error checking required modules: %s", err))
+				return 1
+			}
+			if len(missing) > 0 {
+				c.ui.Error("The following modules are not available offline:")
+				for _, mod := range missing {
+					c.ui.Error(fmt.Sprintf(" * %s", mod))
+				}
+				c.ui.Error("Download them into the module cache with `go mod download` on a host with network access, " +
+					"or pass a file:// GOPROXY with --goproxy.")
+				return 1
+			}
+		}
 	}
 
-	var prettyProviderName string
-	if providerRepoName != "" {
-		prettyProviderName = " " + providerRepoName
+	if dryRun {
+		for _, m := range modules {
+			c.ui.Output(fmt.Sprintf("Running `go mod tidy` against a scratch copy of %s...", util.ModuleDescription(providerPath, m, multiModule)))
+			err = util.GoModTidyPreview(ctx, tc, cs, m.Dir)
+			if err != nil {
+				c.ui.Error(fmt.Sprintf("Error running go mod tidy: %s", err))
+				return 1
+			}
+		}
+
+		var diff strings.Builder
+		err = cs.WriteDiff(&diff, diffRoot)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error writing diff: %s", err))
+			return 1
+		}
+		c.ui.Output(strings.TrimSuffix(diff.String(), "\n"))
+		c.ui.Info(fmt.Sprintf("Dry run complete: %d files would be changed to upgrade to %s %s. No files were modified.",
+			len(cs.Changes()), newPackagePath, util.PrettyVersion(sdkVersion, sdkVersionQuery)))
+		return 0
 	}
-	c.ui.Info(fmt.Sprintf("Success! Provider%s is upgraded to %s %s.",
-		prettyProviderName, newPackagePath, sdkVersion))
 
-	hasVendor, err := HasVendorFolder(providerPath)
+	tx, err := util.BeginTransaction(providerPath, CommandName)
 	if err != nil {
-		c.ui.Error(fmt.Sprintf("Failed to check vendor folder: %s", err))
+		c.ui.Error(fmt.Sprintf("Error starting transaction: %s", err))
 		return 1
 	}
 
-	if hasVendor {
-		c.ui.Info("\nIt looks like this provider vendors dependencies. " +
-			"Don't forget to run `go mod vendor`.")
+	// an interrupt only cancels ctx, so that files are restored here once
+	// the go command it stops has exited, and cannot be written after
+	c.ui.Output("Writing changes...")
+	err = tx.Apply(cs)
+	if err != nil {
+		return util.AbortTransaction(c.ui, tx, "Error writing changes", err)
 	}
 
-	c.ui.Info(fmt.Sprintf("Make sure to review all changes and run all tests."))
-	return 0
-}
+	for _, m := range modules {
+		if ctx.Err() != nil {
+			return util.InterruptTransaction(c.ui, tx)
+		}
+		if multiModule {
+			c.ui.Output(fmt.Sprintf("Running `go mod tidy` for module %s...", m.Path))
+		} else {
+			c.ui.Output("Running `go mod tidy`...")
+		}
+		err = tx.Snapshot(filepath.Join(m.Dir, "go.mod"), filepath.Join(m.Dir, "go.sum"))
+		if err != nil {
+			return util.AbortTransaction(c.ui, tx, "Error writing journal", err)
+		}
+		err = util.GoModTidy(ctx, tc, m.Dir)
+		if ctx.Err() != nil {
+			return util.InterruptTransaction(c.ui, tx)
+		}
+		if err != nil {
+			return util.AbortTransaction(c.ui, tx, "Error running go mod tidy", err)
+		}
+	}
 
-func HasVendorFolder(providerPath string) (bool, error) {
-	vendorPath := filepath.Join(providerPath, "vendor")
-	fs, err := os.Stat(vendorPath)
+	err = tx.Commit()
 	if err != nil {
-		return false, err
-	}
-	if !fs.Mode().IsDir() {
-		return false, fmt.Errorf("%s is not folder (expected folder)", vendorPath)
+		c.ui.Error(fmt.Sprintf("Error completing journal %s: %s", tx.JournalPath(), err))
+		return 1
 	}
 
-	return true, nil
-}
+	var prettyProviderName string
+	if providerRepoName != "" {
+		prettyProviderName = " " + providerRepoName
+	}
+	c.ui.Info(fmt.Sprintf("Success! Provider%s is upgraded to %s %s.",
+		prettyProviderName, newPackagePath, util.PrettyVersion(sdkVersion, sdkVersionQuery)))
+	if multiModule {
+		for _, m := range modules {
+			c.ui.Info(fmt.Sprintf(" * %s", m.Path))
+		}
+	}
 
-type ExecError struct {
-	Err    error
-	Stderr string
-}
+	for _, m := range modules {
+		hasVendor, err := util.HasVendorFolder(m.Dir)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Failed to check vendor folder: %s", err))
+			return 1
+		}
 
-func (ee *ExecError) Error() string {
-	return fmt.Sprintf("%s\n%s", ee.Err, ee.Stderr)
-}
+		if hasVendor {
+			description := "this provider"
+			if multiModule {
+				description = util.ModuleDescription(providerPath, m, multiModule)
+			}
+			c.ui.Info(fmt.Sprintf("\nIt looks like %s vendors dependencies. "+
+				"Don't forget to run `go mod vendor`.", description))
+		}
+	}
 
-func NewExecError(err error, stderr string) *ExecError {
-	return &ExecError{err, stderr}
+	c.ui.Info(fmt.Sprintf("Make sure to review all changes and run all tests. " +
+		"To undo this run, use `tf-sdk-migrator rollback`."))
+	return 0
 }
@@ -0,0 +1,94 @@
+package v2upgrade
+
+import (
+	"go/ast"
+
+	"github.com/hashicorp/tf-sdk-migrator/util"
+)
+
+const validationPackagePath = newPackagePath + "/helper/validation"
+
+// validationRename is the replacement of a helper/validation function
+// removed in SDK v2.
+type validationRename struct {
+	name string
+
+	// factory is set if the removed function returned a validation
+	// function while its replacement is one, so calls of the removed
+	// function are replaced with the replacement itself.
+	factory bool
+}
+
+// validationRenames maps the helper/validation functions removed in SDK
+// v2 which have a direct replacement to it. The last SDK v1 releases
+// already implement the removed functions with their replacements, so
+// renaming them does not change the behavior of the provider.
+var validationRenames = map[string]*validationRename{
+	"CIDRNetwork":               {name: "IsCIDRNetwork"},
+	"IPRange":                   {name: "IsIPv4Range", factory: true},
+	"SingleIP":                  {name: "IsIPAddress", factory: true},
+	"ValidateJsonString":        {name: "StringIsJSON"},
+	"ValidateListUniqueStrings": {name: "ListOfUniqueStrings"},
+	"ValidateRegexp":            {name: "StringIsValidRegExp"},
+	"ValidateRFC3339TimeString": {name: "IsRFC3339Time"},
+}
+
+// renameValidationFuncs rewrites references to helper/validation
+// functions removed in SDK v2 to their replacements, see
+// validationRenames.
+func renameValidationFuncs(pkg *codemodPackage) (int, []*codemodIssue) {
+	var issues []*codemodIssue
+
+	renamed := 0
+	for _, file := range pkg.files {
+		validationName := util.ImportName(file.ast, validationPackagePath)
+		if validationName == "" {
+			continue
+		}
+
+		// collect the references first, factory calls are replaced in
+		// their parent
+		type reference struct {
+			sel   *ast.SelectorExpr
+			stack []ast.Node
+		}
+		var refs []*reference
+		var stack []ast.Node
+		ast.Inspect(file.ast, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			defer func() { stack = append(stack, n) }()
+
+			sel, ok := n.(*ast.SelectorExpr)
+			if ok && validationRenames[sel.Sel.Name] != nil && isQualified(sel, validationName, sel.Sel.Name) {
+				refs = append(refs, &reference{sel, append([]ast.Node(nil), stack...)})
+			}
+			return true
+		})
+
+		for _, ref := range refs {
+			old := ref.sel.Sel.Name
+			rename := validationRenames[old]
+
+			if rename.factory {
+				var call *ast.CallExpr
+				if len(ref.stack) > 1 {
+					call, _ = ref.stack[len(ref.stack)-1].(*ast.CallExpr)
+				}
+				if call == nil || call.Fun != ref.sel || len(call.Args) != 0 || !replaceExpr(ref.stack[len(ref.stack)-2], call, ref.sel) {
+					issues = append(issues, pkg.issue(ref.sel.Pos(), "validation.%s is not called without arguments, so it cannot be replaced with validation.%s, which is a validation function itself", old, rename.name))
+					continue
+				}
+			}
+
+			ref.sel.Sel = &ast.Ident{NamePos: ref.sel.Sel.NamePos, Name: rename.name}
+			file.modified = true
+			renamed++
+		}
+	}
+
+	sortIssues(issues)
+	return renamed, issues
+}
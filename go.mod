@@ -1,12 +1,24 @@
 module github.com/hashicorp/tf-sdk-migrator
 
-go 1.12
+go 1.22.0
 
 require (
 	github.com/hashicorp/go-version v1.2.0
 	github.com/hashicorp/logutils v1.0.0
-	github.com/kmoe/go-list v1.0.0
 	github.com/mitchellh/cli v1.0.0
-	github.com/radeksimko/go-refs v0.0.0-20190823125319-880a3294a1a0
-	golang.org/x/mod v0.2.0
+	golang.org/x/mod v0.21.0
+	golang.org/x/tools v0.26.0
+)
+
+require (
+	github.com/armon/go-radix v0.0.0-20180808171621-7fddfc383310 // indirect
+	github.com/bgentry/speakeasy v0.1.0 // indirect
+	github.com/fatih/color v1.7.0 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.0.0 // indirect
+	github.com/mattn/go-colorable v0.0.9 // indirect
+	github.com/mattn/go-isatty v0.0.3 // indirect
+	github.com/posener/complete v1.1.1 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/sys v0.26.0 // indirect
 )
@@ -7,6 +7,8 @@ import (
 	"github.com/hashicorp/logutils"
 	"github.com/hashicorp/tf-sdk-migrator/cmd/check"
 	"github.com/hashicorp/tf-sdk-migrator/cmd/migrate"
+	"github.com/hashicorp/tf-sdk-migrator/cmd/rollback"
+	"github.com/hashicorp/tf-sdk-migrator/cmd/v2check"
 	"github.com/hashicorp/tf-sdk-migrator/cmd/v2upgrade"
 	"github.com/mitchellh/cli"
 )
@@ -36,6 +38,8 @@ func main() {
 	c.Commands = map[string]cli.CommandFactory{
 		check.CommandName:     check.CommandFactory(ui),
 		migrate.CommandName:   migrate.CommandFactory(ui),
+		rollback.CommandName:  rollback.CommandFactory(ui),
+		v2check.CommandName:   v2check.CommandFactory(ui),
 		v2upgrade.CommandName: v2upgrade.CommandFactory(ui),
 	}
 
@@ -0,0 +1,203 @@
+package util
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ImportName returns the name under which importPath is imported in f,
+// or an empty string if f does not import it.
+func ImportName(f *ast.File, importPath string) string {
+	for _, impSpec := range f.Imports {
+		impPath, err := strconv.Unquote(impSpec.Path.Value)
+		if err != nil || impPath != importPath {
+			continue
+		}
+		if impSpec.Name != nil {
+			return impSpec.Name.Name
+		}
+		return DefaultPackageName(importPath)
+	}
+	return ""
+}
+
+// DefaultPackageName guesses the name of the package at importPath
+// from its last path element, skipping major version suffixes.
+func DefaultPackageName(importPath string) string {
+	name := path.Base(importPath)
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = path.Base(path.Dir(importPath))
+	}
+	name = strings.TrimPrefix(name, "go-")
+	return strings.Replace(name, "-", "_", -1)
+}
+
+// AddImport adds an import of importPath to f unless it is already
+// imported, and returns the name under which it can be referenced.
+// Standard library packages are added in order among the imports of the
+// standard library, or before all other imports, others after the last
+// import.
+func AddImport(fset *token.FileSet, f *ast.File, importPath string) string {
+	if name := ImportName(f, importPath); name != "" {
+		return name
+	}
+
+	var decl *ast.GenDecl
+	for _, d := range f.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			decl = gd
+			break
+		}
+	}
+
+	pos := f.Name.End()
+	index := 0
+	standard := isStandardImport(importPath)
+	if decl != nil && len(decl.Specs) > 0 {
+		if standard {
+			index, pos = standardImportIndex(decl, importPath)
+		} else {
+			index = len(decl.Specs)
+			pos = decl.Specs[index-1].End()
+		}
+	}
+	spec := &ast.ImportSpec{
+		Path: &ast.BasicLit{
+			ValuePos: pos,
+			Kind:     token.STRING,
+			Value:    strconv.Quote(importPath),
+		},
+		EndPos: pos,
+	}
+
+	if decl == nil {
+		decl = &ast.GenDecl{TokPos: pos, Tok: token.IMPORT}
+		f.Decls = append([]ast.Decl{decl}, f.Decls...)
+	}
+	if !decl.Lparen.IsValid() {
+		decl.Lparen = decl.TokPos
+		decl.Rparen = pos
+	}
+	decl.Specs = append(decl.Specs[:index], append([]ast.Spec{spec}, decl.Specs[index:]...)...)
+	f.Imports = append(f.Imports, spec)
+	if !standard {
+		// sorting would merge a standard library group with the next
+		// one, and standard library packages are inserted in order
+		ast.SortImports(fset, f)
+	}
+
+	return DefaultPackageName(importPath)
+}
+
+// standardImportIndex returns the index and position at which the
+// standard library package importPath is inserted into decl, keeping the
+// imports of the standard library sorted and before all others.
+func standardImportIndex(decl *ast.GenDecl, importPath string) (int, token.Pos) {
+	index, pos := 0, decl.Specs[0].Pos()
+	for i, s := range decl.Specs {
+		spec := s.(*ast.ImportSpec)
+		impPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || !isStandardImport(impPath) {
+			continue
+		}
+		if impPath > importPath {
+			return i, spec.Pos()
+		}
+		index, pos = i+1, spec.End()
+	}
+	return index, pos
+}
+
+// DeleteUnusedImport removes the import of importPath from f if it is
+// no longer referenced, and reports whether it did.
+func DeleteUnusedImport(fset *token.FileSet, f *ast.File, importPath string) bool {
+	name := ImportName(f, importPath)
+	if name == "" || name == "_" || name == "." {
+		return false
+	}
+	used := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil && x.Name == name {
+				used = true
+			}
+		}
+		return !used
+	})
+	if used {
+		return false
+	}
+
+	for i, d := range f.Decls {
+		decl, ok := d.(*ast.GenDecl)
+		if !ok || decl.Tok != token.IMPORT {
+			continue
+		}
+		for j, s := range decl.Specs {
+			spec := s.(*ast.ImportSpec)
+			if impPath, err := strconv.Unquote(spec.Path.Value); err != nil || impPath != importPath {
+				continue
+			}
+
+			if len(decl.Specs) == 1 {
+				f.Decls = append(f.Decls[:i], f.Decls[i+1:]...)
+			} else {
+				removeSpecLines(fset, decl, j)
+				decl.Specs = append(decl.Specs[:j], decl.Specs[j+1:]...)
+			}
+			for k, imp := range f.Imports {
+				if imp == spec {
+					f.Imports = append(f.Imports[:k], f.Imports[k+1:]...)
+					break
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// removeSpecLines merges the lines of the j-th spec of decl with the
+// surrounding ones, so that removing it leaves at most one empty line
+// between the neighbouring groups of imports, and none after the
+// opening parenthesis.
+func removeSpecLines(fset *token.FileSet, decl *ast.GenDecl, j int) {
+	tokFile := fset.File(decl.Specs[j].Pos())
+	line := tokFile.Line(decl.Specs[j].Pos())
+	prev := tokFile.Line(decl.Lparen)
+	if j > 0 {
+		prev = tokFile.Line(decl.Specs[j-1].End())
+	}
+	next := tokFile.Line(decl.Rparen)
+	if j < len(decl.Specs)-1 {
+		next = tokFile.Line(decl.Specs[j+1].Pos())
+	}
+
+	gap := 1
+	if j > 0 && j < len(decl.Specs)-1 && (line-prev > 1 || next-line > 1) {
+		gap = 2
+	}
+	for n := next - prev - gap; n > 0 && line-1 < tokFile.LineCount(); n-- {
+		tokFile.MergeLine(line - 1)
+	}
+}
+
+// isStandardImport reports whether importPath belongs to the standard
+// library, whose import paths have no dot in their first element.
+func isStandardImport(importPath string) bool {
+	first := strings.SplitN(importPath, "/", 2)[0]
+	return !strings.Contains(first, ".")
+}
+
+// FormatFile prints f in the same style as the rest of the rewrites.
+func FormatFile(fset *token.FileSet, f *ast.File) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := printConfig.Fprint(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
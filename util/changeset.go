@@ -0,0 +1,110 @@
+package util
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Changeset collects file modifications in memory, so that they can be
+// reviewed as a diff before anything on disk is touched.
+type Changeset struct {
+	files map[string]*FileChange
+}
+
+// FileChange describes the staged content of a single file.
+type FileChange struct {
+	Path     string
+	Mode     os.FileMode
+	Existed  bool
+	Original []byte
+	Content  []byte
+}
+
+func (fc *FileChange) Modified() bool {
+	return !fc.Existed || string(fc.Original) != string(fc.Content)
+}
+
+func NewChangeset() *Changeset {
+	return &Changeset{
+		files: make(map[string]*FileChange),
+	}
+}
+
+// ReadFile returns the staged content of path if there is any,
+// otherwise the content on disk.
+func (cs *Changeset) ReadFile(path string) ([]byte, error) {
+	if fc, ok := cs.files[filepath.Clean(path)]; ok {
+		return fc.Content, nil
+	}
+	return ioutil.ReadFile(path)
+}
+
+// WriteFile stages new content for path without writing it to disk.
+func (cs *Changeset) WriteFile(path string, content []byte) error {
+	path = filepath.Clean(path)
+	if fc, ok := cs.files[path]; ok {
+		fc.Content = content
+		return nil
+	}
+
+	fc := &FileChange{
+		Path:    path,
+		Mode:    0644,
+		Content: content,
+	}
+	info, err := os.Stat(path)
+	if err == nil {
+		original, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fc.Existed = true
+		fc.Mode = info.Mode().Perm()
+		fc.Original = original
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	cs.files[path] = fc
+	return nil
+}
+
+// Changes returns the staged files which differ from their
+// original content, sorted by path.
+func (cs *Changeset) Changes() []*FileChange {
+	changes := make([]*FileChange, 0, len(cs.files))
+	for _, fc := range cs.files {
+		if fc.Modified() {
+			changes = append(changes, fc)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// WriteDiff writes a unified diff of every staged change to w,
+// with file names relative to root.
+func (cs *Changeset) WriteDiff(w io.Writer, root string) error {
+	for _, fc := range cs.Changes() {
+		name, err := filepath.Rel(root, fc.Path)
+		if err != nil {
+			name = fc.Path
+		}
+		name = filepath.ToSlash(name)
+
+		fromName := "a/" + name
+		if !fc.Existed {
+			fromName = "/dev/null"
+		}
+		_, err = io.WriteString(w, UnifiedDiff(fromName, "b/"+name, fc.Original, fc.Content))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "equal",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: "",
+		},
+		{
+			name: "both empty",
+			a:    "",
+			b:    "",
+			want: "",
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    "a\nb\n",
+			want: `--- a/f
++++ b/f
+@@ -0,0 +1,2 @@
++a
++b
+`,
+		},
+		{
+			name: "to empty",
+			a:    "a\nb\n",
+			b:    "",
+			want: `--- a/f
++++ b/f
+@@ -1,2 +0,0 @@
+-a
+-b
+`,
+		},
+		{
+			name: "change with context",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:    "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: `--- a/f
++++ b/f
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+`,
+		},
+		{
+			name: "separate hunks",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			b:    "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			want: `--- a/f
++++ b/f
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -9,4 +9,4 @@
+ 9
+ 10
+ 11
+-12
++twelve
+`,
+		},
+		{
+			name: "newline added at end of file",
+			a:    "a\nb",
+			b:    "a\nb\n",
+			want: `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`,
+		},
+		{
+			name: "line appended without newline",
+			a:    "a\n",
+			b:    "a\nb",
+			want: `--- a/f
++++ b/f
+@@ -1 +1,2 @@
+ a
++b
+\ No newline at end of file
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := UnifiedDiff("a/f", "b/f", []byte(tc.a), []byte(tc.b))
+			if got != tc.want {
+				t.Errorf("unexpected diff\ngot:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	cases := []struct {
+		a, b string
+	}{
+		{"", ""},
+		{"", "a\n"},
+		{"a\n", ""},
+		{"a\nb\nc\n", "a\nc\n"},
+		{"a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n"},
+		{"x", "x\n"},
+	}
+
+	for _, tc := range cases {
+		a, b := splitLines(tc.a), splitLines(tc.b)
+		ops := diffLines(a, b)
+
+		// applying the edit script to a must give b, and the lines kept
+		// or removed must be a
+		var gotA, gotB []string
+		for _, op := range ops {
+			if op.kind != '+' {
+				gotA = append(gotA, op.line)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.line)
+			}
+		}
+		if strings.Join(gotA, "") != tc.a || strings.Join(gotB, "") != tc.b {
+			t.Errorf("diffLines(%q, %q) = %v, which does not turn one into the other", tc.a, tc.b, ops)
+		}
+	}
+}
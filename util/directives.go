@@ -0,0 +1,250 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// ModuleDirective is a replace or exclude directive in go.mod.
+type ModuleDirective struct {
+	// Kind is either "replace" or "exclude".
+	Kind string
+
+	// Old is the replaced or excluded module. Its version is empty if
+	// every version is replaced.
+	Old module.Version
+
+	// New is the replacement. Its version is empty if it is a local
+	// path.
+	New module.Version
+}
+
+// IsLocal reports whether d replaces a module with a local directory.
+func (d *ModuleDirective) IsLocal() bool {
+	return d.Kind == "replace" && d.New.Version == ""
+}
+
+// ShadowsVersion reports whether d replaces version of its module, so
+// that requiring version has no effect on the code which is built.
+func (d *ModuleDirective) ShadowsVersion(version string) bool {
+	return d.Kind == "replace" && (d.Old.Version == "" || d.Old.Version == version)
+}
+
+// String formats d as it appears in go.mod.
+func (d *ModuleDirective) String() string {
+	old := strings.TrimSpace(d.Old.Path + " " + d.Old.Version)
+	if d.Kind == "exclude" {
+		return fmt.Sprintf("exclude %s", old)
+	}
+	return fmt.Sprintf("replace %s => %s", old, strings.TrimSpace(d.New.Path+" "+d.New.Version))
+}
+
+// ReadModuleDirectives returns the replace and exclude directives for
+// modPath in the go.mod of the module at modulePath.
+func ReadModuleDirectives(modulePath, modPath string) ([]*ModuleDirective, error) {
+	goModPath := filepath.Join(modulePath, "go.mod")
+	content, err := ioutil.ReadFile(goModPath)
+	if err != nil {
+		return nil, err
+	}
+	pf, err := modfile.Parse(goModPath, content, nil)
+	if err != nil {
+		return nil, err
+	}
+	return moduleDirectives(pf, modPath), nil
+}
+
+func moduleDirectives(pf *modfile.File, modPath string) []*ModuleDirective {
+	var directives []*ModuleDirective
+	for _, r := range pf.Replace {
+		if r.Old.Path == modPath {
+			directives = append(directives, &ModuleDirective{Kind: "replace", Old: r.Old, New: r.New})
+		}
+	}
+	for _, e := range pf.Exclude {
+		if e.Mod.Path == modPath {
+			directives = append(directives, &ModuleDirective{Kind: "exclude", Old: e.Mod})
+		}
+	}
+	return directives
+}
+
+// EquivalentFork returns the module path of the fork of newPath
+// corresponding to fork, a fork of oldPath: the fork of
+// github.com/hashicorp/terraform at github.com/example/terraform
+// corresponds to github.com/example/terraform-plugin-sdk. It returns an
+// empty string if there is no obvious equivalent.
+func EquivalentFork(oldPath, newPath, fork string) string {
+	if strings.HasPrefix(newPath, oldPath+"/") {
+		// a new major version of the same module
+		return fork + strings.TrimPrefix(newPath, oldPath)
+	}
+	if path.Base(fork) == path.Base(oldPath) {
+		return path.Join(path.Dir(fork), path.Base(newPath))
+	}
+	return ""
+}
+
+// ResolveReplacement resolves the target of a replace directive: a
+// local directory, or a module path with an optional @version query,
+// which defaults to latest.
+func (t *Toolchain) ResolveReplacement(ctx context.Context, s string) (*module.Version, error) {
+	if modfile.IsDirectoryPath(s) {
+		return &module.Version{Path: s}, nil
+	}
+
+	modPath, query := s, "latest"
+	if i := strings.Index(s, "@"); i >= 0 {
+		modPath, query = s[:i], s[i+1:]
+		if query == "" {
+			return nil, fmt.Errorf("missing version in %q", s)
+		}
+	}
+	if err := module.CheckPath(modPath); err != nil {
+		return nil, err
+	}
+
+	v, err := t.ResolveModuleVersion(ctx, modPath, query)
+	if err != nil {
+		return nil, err
+	}
+	return &module.Version{Path: modPath, Version: v}, nil
+}
+
+// DropModuleDirectives stages the removal of the replace and exclude
+// directives for modPath from the go.mod of the module at modulePath,
+// which become stale once it no longer requires modPath. The removed
+// directives are returned.
+func DropModuleDirectives(cs *Changeset, modulePath, modPath string) ([]*ModuleDirective, error) {
+	var removed []*ModuleDirective
+	err := editGoMod(cs, modulePath, func(pf *modfile.File) error {
+		removed = moduleDirectives(pf, modPath)
+		for _, d := range removed {
+			var err error
+			if d.Kind == "exclude" {
+				err = pf.DropExclude(d.Old.Path, d.Old.Version)
+			} else {
+				err = pf.DropReplace(d.Old.Path, d.Old.Version)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// ReplaceModule stages a replace directive for every version of modPath
+// in the go.mod of the module at modulePath, superseding any existing
+// replace directive for it.
+func ReplaceModule(cs *Changeset, modulePath, modPath string, replacement module.Version) error {
+	return editGoMod(cs, modulePath, func(pf *modfile.File) error {
+		return pf.AddReplace(modPath, "", replacement.Path, replacement.Version)
+	})
+}
+
+// RewriteModuleDirectives removes the replace and exclude directives for
+// oldPath from the go.mod of m, which are stale once it is migrated to
+// newPath, and replaces newPath with replacement if set. Otherwise, it
+// warns about replace directives which shadow version. If the module is
+// shared with packages which are not migrated, the directives for
+// oldPath are kept. Changes are staged in cs and reported to ui.
+func RewriteModuleDirectives(ui cli.Ui, cs *Changeset, m *Module, shared bool, oldPath, newPath string, replacement *module.Version, version string) error {
+	if shared {
+		// other packages of the module may still depend on oldPath
+		directives, err := ReadModuleDirectives(m.Dir, oldPath)
+		if err != nil {
+			return err
+		}
+		for _, d := range directives {
+			ui.Warn(fmt.Sprintf("Keeping %s, since other packages of module %s may still depend on %s.", d, m.Path, oldPath))
+		}
+	} else {
+		removed, err := DropModuleDirectives(cs, m.Dir, oldPath)
+		if err != nil {
+			return err
+		}
+		for _, d := range removed {
+			switch {
+			case d.Kind == "exclude":
+				ui.Output(fmt.Sprintf("Removed stale %s.", d))
+			case d.IsLocal():
+				ui.Warn(fmt.Sprintf("Removed %s: the local copy of %s is no longer used.", d, oldPath))
+			case replacement == nil:
+				msg := fmt.Sprintf("Removed %s. To keep using a fork, pass the fork of %s to --replace-fork", d, newPath)
+				if fork := EquivalentFork(oldPath, newPath, d.New.Path); fork != "" {
+					msg += fmt.Sprintf(", e.g. --replace-fork %s@VERSION", fork)
+				}
+				ui.Warn(msg + ".")
+			default:
+				ui.Output(fmt.Sprintf("Removed %s.", d))
+			}
+		}
+	}
+
+	if replacement != nil {
+		ui.Output(fmt.Sprintf("Replacing %s with %s...", newPath,
+			strings.TrimSpace(replacement.Path+" "+replacement.Version)))
+		return ReplaceModule(cs, m.Dir, newPath, *replacement)
+	}
+
+	directives, err := ReadModuleDirectives(m.Dir, newPath)
+	if err != nil {
+		return err
+	}
+	for _, d := range directives {
+		if !d.ShadowsVersion(version) {
+			continue
+		}
+		if d.IsLocal() {
+			ui.Warn(fmt.Sprintf("Warning: %s shadows the upgrade, %s will be built from the local copy in %s instead of %s.",
+				d, newPath, d.New.Path, version))
+		} else {
+			ui.Warn(fmt.Sprintf("Warning: %s shadows the upgrade, %s will be built from %s %s instead of %s.",
+				d, newPath, d.New.Path, d.New.Version, version))
+		}
+	}
+	return nil
+}
+
+// editGoMod stages the changes made by edit to the go.mod of the module
+// at modulePath.
+func editGoMod(cs *Changeset, modulePath string, edit func(pf *modfile.File) error) error {
+	goModPath := filepath.Join(modulePath, "go.mod")
+
+	input, err := cs.ReadFile(goModPath)
+	if err != nil {
+		return err
+	}
+
+	pf, err := modfile.Parse(goModPath, input, nil)
+	if err != nil {
+		return err
+	}
+
+	err = edit(pf)
+	if err != nil {
+		return err
+	}
+
+	pf.Cleanup()
+	formattedOutput, err := pf.Format()
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(formattedOutput, input) {
+		return nil
+	}
+
+	return cs.WriteFile(goModPath, formattedOutput)
+}
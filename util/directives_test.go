@@ -0,0 +1,279 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/mod/module"
+)
+
+const (
+	testTerraformPath = "github.com/hashicorp/terraform"
+	testSDKPath       = "github.com/hashicorp/terraform-plugin-sdk"
+	testSDKv2Path     = "github.com/hashicorp/terraform-plugin-sdk/v2"
+)
+
+// stageGoMod writes content as the go.mod of a temporary module and
+// returns its directory along with a changeset to stage edits in.
+func stageGoMod(t *testing.T, content string) (string, *Changeset) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tf-sdk-migrator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir, NewChangeset()
+}
+
+func stagedGoMod(t *testing.T, cs *Changeset, dir string) string {
+	t.Helper()
+	content, err := cs.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestDropModuleDirectives(t *testing.T) {
+	cases := []struct {
+		name        string
+		goMod       string
+		modPath     string
+		wantRemoved []string
+		wantGoMod   string
+	}{
+		{
+			name:    "versioned and unversioned replaces",
+			modPath: testTerraformPath,
+			goMod: `module example.com/provider
+
+require github.com/hashicorp/terraform v0.12.7
+
+replace github.com/hashicorp/terraform v0.12.7 => github.com/example/terraform v0.12.7-fork
+
+replace github.com/hashicorp/terraform => github.com/example/terraform v0.12.8-fork
+
+replace github.com/hashicorp/go-getter => github.com/example/go-getter v1.4.0
+`,
+			wantRemoved: []string{
+				"replace github.com/hashicorp/terraform v0.12.7 => github.com/example/terraform v0.12.7-fork",
+				"replace github.com/hashicorp/terraform => github.com/example/terraform v0.12.8-fork",
+			},
+			wantGoMod: `module example.com/provider
+
+require github.com/hashicorp/terraform v0.12.7
+
+replace github.com/hashicorp/go-getter => github.com/example/go-getter v1.4.0
+`,
+		},
+		{
+			name:    "local path and excludes",
+			modPath: testTerraformPath,
+			goMod: `module example.com/provider
+
+require github.com/hashicorp/terraform v0.12.7
+
+replace github.com/hashicorp/terraform => ../terraform
+
+exclude (
+	github.com/hashicorp/terraform v0.12.6
+	github.com/hashicorp/go-getter v1.3.0
+)
+`,
+			wantRemoved: []string{
+				"replace github.com/hashicorp/terraform => ../terraform",
+				"exclude github.com/hashicorp/terraform v0.12.6",
+			},
+			wantGoMod: `module example.com/provider
+
+require github.com/hashicorp/terraform v0.12.7
+
+exclude github.com/hashicorp/go-getter v1.3.0
+`,
+		},
+		{
+			name:    "other major version",
+			modPath: testSDKPath,
+			goMod: `module example.com/provider
+
+replace github.com/hashicorp/terraform-plugin-sdk/v2 => ../sdk
+`,
+			wantRemoved: []string{},
+			wantGoMod: `module example.com/provider
+
+replace github.com/hashicorp/terraform-plugin-sdk/v2 => ../sdk
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, cs := stageGoMod(t, tc.goMod)
+			defer os.RemoveAll(dir)
+
+			removed, err := DropModuleDirectives(cs, dir, tc.modPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotRemoved := []string{}
+			for _, d := range removed {
+				gotRemoved = append(gotRemoved, d.String())
+			}
+			if !reflect.DeepEqual(gotRemoved, tc.wantRemoved) {
+				t.Errorf("unexpected removed directives\ngot:  %q\nwant: %q", gotRemoved, tc.wantRemoved)
+			}
+			if got := stagedGoMod(t, cs, dir); got != tc.wantGoMod {
+				t.Errorf("unexpected go.mod\ngot:\n%s\nwant:\n%s", got, tc.wantGoMod)
+			}
+			if len(tc.wantRemoved) == 0 && len(cs.Changes()) != 0 {
+				t.Errorf("expected no changes, got %d", len(cs.Changes()))
+			}
+		})
+	}
+}
+
+func TestReplaceModule(t *testing.T) {
+	cases := []struct {
+		name        string
+		goMod       string
+		replacement module.Version
+		wantGoMod   string
+	}{
+		{
+			name: "new replace",
+			goMod: `module example.com/provider
+
+require github.com/hashicorp/terraform-plugin-sdk/v2 v2.4.3
+`,
+			replacement: module.Version{Path: "github.com/example/terraform-plugin-sdk/v2", Version: "v2.4.3-fork"},
+			wantGoMod: `module example.com/provider
+
+require github.com/hashicorp/terraform-plugin-sdk/v2 v2.4.3
+
+replace github.com/hashicorp/terraform-plugin-sdk/v2 => github.com/example/terraform-plugin-sdk/v2 v2.4.3-fork
+`,
+		},
+		{
+			name: "supersedes versioned replace",
+			goMod: `module example.com/provider
+
+require github.com/hashicorp/terraform-plugin-sdk/v2 v2.4.3
+
+replace github.com/hashicorp/terraform-plugin-sdk/v2 v2.4.3 => github.com/example/terraform-plugin-sdk/v2 v2.4.3-old
+`,
+			replacement: module.Version{Path: "../terraform-plugin-sdk"},
+			wantGoMod: `module example.com/provider
+
+require github.com/hashicorp/terraform-plugin-sdk/v2 v2.4.3
+
+replace github.com/hashicorp/terraform-plugin-sdk/v2 => ../terraform-plugin-sdk
+`,
+		},
+		{
+			name: "supersedes unversioned replace",
+			goMod: `module example.com/provider
+
+require github.com/hashicorp/terraform-plugin-sdk/v2 v2.4.3
+
+replace github.com/hashicorp/terraform-plugin-sdk/v2 => ../old-sdk
+`,
+			replacement: module.Version{Path: "../terraform-plugin-sdk"},
+			wantGoMod: `module example.com/provider
+
+require github.com/hashicorp/terraform-plugin-sdk/v2 v2.4.3
+
+replace github.com/hashicorp/terraform-plugin-sdk/v2 => ../terraform-plugin-sdk
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, cs := stageGoMod(t, tc.goMod)
+			defer os.RemoveAll(dir)
+
+			if err := ReplaceModule(cs, dir, testSDKv2Path, tc.replacement); err != nil {
+				t.Fatal(err)
+			}
+			if got := stagedGoMod(t, cs, dir); got != tc.wantGoMod {
+				t.Errorf("unexpected go.mod\ngot:\n%s\nwant:\n%s", got, tc.wantGoMod)
+			}
+		})
+	}
+}
+
+func TestEquivalentFork(t *testing.T) {
+	cases := []struct {
+		oldPath, newPath, fork string
+		want                   string
+	}{
+		{testTerraformPath, testSDKPath, "github.com/example/terraform", "github.com/example/terraform-plugin-sdk"},
+		{testTerraformPath, testSDKPath, "gitlab.com/group/sub/terraform", "gitlab.com/group/sub/terraform-plugin-sdk"},
+		{testTerraformPath, testSDKPath, "github.com/example/tf", ""},
+		{testSDKPath, testSDKv2Path, "github.com/example/terraform-plugin-sdk", "github.com/example/terraform-plugin-sdk/v2"},
+		{testSDKPath, testSDKv2Path, "github.com/example/sdk-fork", "github.com/example/sdk-fork/v2"},
+	}
+
+	for _, tc := range cases {
+		if got := EquivalentFork(tc.oldPath, tc.newPath, tc.fork); got != tc.want {
+			t.Errorf("EquivalentFork(%q, %q, %q) = %q, want %q", tc.oldPath, tc.newPath, tc.fork, got, tc.want)
+		}
+	}
+}
+
+func TestModuleDirectiveShadowsVersion(t *testing.T) {
+	v := func(path, version string) module.Version {
+		return module.Version{Path: path, Version: version}
+	}
+
+	cases := []struct {
+		name    string
+		d       *ModuleDirective
+		version string
+		want    bool
+	}{
+		{
+			name:    "unversioned replace",
+			d:       &ModuleDirective{Kind: "replace", Old: v(testSDKv2Path, ""), New: v("github.com/example/sdk/v2", "v2.0.0")},
+			version: "v2.4.3",
+			want:    true,
+		},
+		{
+			name:    "replace of the same version",
+			d:       &ModuleDirective{Kind: "replace", Old: v(testSDKv2Path, "v2.4.3"), New: v("github.com/example/sdk/v2", "v2.4.3-fork")},
+			version: "v2.4.3",
+			want:    true,
+		},
+		{
+			name:    "replace of another version",
+			d:       &ModuleDirective{Kind: "replace", Old: v(testSDKv2Path, "v2.0.0"), New: v("github.com/example/sdk/v2", "v2.0.0-fork")},
+			version: "v2.4.3",
+			want:    false,
+		},
+		{
+			name:    "local path",
+			d:       &ModuleDirective{Kind: "replace", Old: v(testSDKv2Path, ""), New: v("../sdk", "")},
+			version: "v2.4.3",
+			want:    true,
+		},
+		{
+			name:    "exclude",
+			d:       &ModuleDirective{Kind: "exclude", Old: v(testSDKv2Path, "v2.4.3")},
+			version: "v2.4.3",
+			want:    false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.d.ShadowsVersion(tc.version); got != tc.want {
+				t.Errorf("%s: ShadowsVersion(%q) = %v, want %v", tc.d, tc.version, got, tc.want)
+			}
+		})
+	}
+}
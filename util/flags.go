@@ -0,0 +1,18 @@
+package util
+
+import (
+	"strings"
+)
+
+// StringSliceFlag is a flag.Value collecting every occurrence of a
+// repeatable flag.
+type StringSliceFlag []string
+
+func (s *StringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *StringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
@@ -0,0 +1,143 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// ModuleGraph is the requirement graph of a module, as printed by
+// `go mod graph`, along with the version of each module selected in its
+// build list.
+type ModuleGraph struct {
+	// Main is the path of the main module.
+	Main string
+
+	// Selected maps module paths to their selected version.
+	Selected map[string]string
+
+	// Requires maps path@version of each module, or the path of the
+	// main module, to its requirements.
+	Requires map[string][]module.Version
+}
+
+// LoadModuleGraph loads the module graph of the module at modulePath.
+// The go.mod files of every module in the graph must be available, in
+// the module cache or through GOPROXY.
+func LoadModuleGraph(ctx context.Context, tc *Toolchain, modulePath string) (*ModuleGraph, error) {
+	// the build list cannot be computed from vendor/modules.txt
+	out, err := tc.Run(ctx, modulePath, "list", "-mod=readonly", "-m", "-f", "{{.Path}} {{.Version}}", "all")
+	if err != nil {
+		return nil, err
+	}
+
+	g := &ModuleGraph{
+		Selected: make(map[string]string),
+		Requires: make(map[string][]module.Version),
+	}
+	for i, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if i == 0 {
+			g.Main = fields[0]
+			continue
+		}
+		if len(fields) == 2 {
+			g.Selected[fields[0]] = fields[1]
+		}
+	}
+
+	out, err = tc.Run(ctx, modulePath, "mod", "graph")
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		req, err := parseModuleVersion(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse go mod graph output: %s", err)
+		}
+		g.Requires[fields[0]] = append(g.Requires[fields[0]], req)
+	}
+	return g, scanner.Err()
+}
+
+func parseModuleVersion(s string) (module.Version, error) {
+	i := strings.LastIndex(s, "@")
+	if i < 0 {
+		return module.Version{}, fmt.Errorf("missing version in %q", s)
+	}
+	return module.Version{Path: s[:i], Version: s[i+1:]}, nil
+}
+
+// ChainsTo returns, for every module in the build list other than the
+// main module which requires modPath, the shortest chain of
+// requirements from the main module to it, followed by its requirement
+// of modPath. Only the selected version of each module is followed.
+// Chains are sorted by the module requiring modPath.
+func (g *ModuleGraph) ChainsTo(modPath string) [][]module.Version {
+	key := func(m module.Version) string {
+		if m.Version == "" {
+			return m.Path
+		}
+		return m.Path + "@" + m.Version
+	}
+
+	// breadth-first, so that the first chain found is the shortest
+	main := module.Version{Path: g.Main}
+	parents := map[string]module.Version{}
+	visited := map[string]bool{g.Main: true}
+	queue := []module.Version{main}
+	var requiring []module.Version
+	for len(queue) > 0 {
+		m := queue[0]
+		queue = queue[1:]
+
+		for _, req := range g.Requires[key(m)] {
+			if req.Path == modPath {
+				if m != main {
+					requiring = append(requiring, m)
+				}
+				continue
+			}
+			if g.Selected[req.Path] != req.Version || visited[key(req)] {
+				continue
+			}
+			visited[key(req)] = true
+			parents[key(req)] = m
+			queue = append(queue, req)
+		}
+	}
+
+	sort.Slice(requiring, func(i, j int) bool {
+		return requiring[i].Path < requiring[j].Path
+	})
+
+	chains := make([][]module.Version, 0, len(requiring))
+	for _, m := range requiring {
+		chain := []module.Version{}
+		for _, req := range g.Requires[key(m)] {
+			if req.Path == modPath {
+				chain = append(chain, req)
+				break
+			}
+		}
+		for n := m; n != main; n = parents[key(n)] {
+			chain = append([]module.Version{n}, chain...)
+		}
+		chains = append(chains, append([]module.Version{main}, chain...))
+	}
+	return chains
+}
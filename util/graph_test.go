@@ -0,0 +1,132 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/mod/module"
+)
+
+func TestModuleGraphChainsTo(t *testing.T) {
+	v := func(path, version string) module.Version {
+		return module.Version{Path: path, Version: version}
+	}
+	main := v("example.com/provider", "")
+	sdk := "github.com/hashicorp/terraform-plugin-sdk"
+
+	cases := []struct {
+		name string
+		g    *ModuleGraph
+		want [][]module.Version
+	}{
+		{
+			name: "no requirement",
+			g: &ModuleGraph{
+				Main:     main.Path,
+				Selected: map[string]string{"example.com/a": "v1.0.0"},
+				Requires: map[string][]module.Version{
+					"example.com/provider": {v("example.com/a", "v1.0.0")},
+				},
+			},
+			want: [][]module.Version{},
+		},
+		{
+			name: "main module only",
+			g: &ModuleGraph{
+				Main:     main.Path,
+				Selected: map[string]string{sdk: "v1.7.0"},
+				Requires: map[string][]module.Version{
+					"example.com/provider": {v(sdk, "v1.7.0")},
+				},
+			},
+			want: [][]module.Version{},
+		},
+		{
+			name: "shortest chain",
+			g: &ModuleGraph{
+				Main: main.Path,
+				Selected: map[string]string{
+					"example.com/a": "v1.0.0",
+					"example.com/b": "v1.0.0",
+					"example.com/c": "v1.0.0",
+					sdk:             "v1.7.0",
+				},
+				Requires: map[string][]module.Version{
+					"example.com/provider":     {v("example.com/a", "v1.0.0"), v("example.com/b", "v1.0.0")},
+					"example.com/a@v1.0.0":     {v("example.com/c", "v1.0.0")},
+					"example.com/b@v1.0.0":     {v("example.com/c", "v1.0.0")},
+					"example.com/c@v1.0.0":     {v(sdk, "v1.4.0")},
+					"github.com/x/unused@v1.0": {v(sdk, "v1.0.0")},
+				},
+			},
+			want: [][]module.Version{
+				{main, v("example.com/a", "v1.0.0"), v("example.com/c", "v1.0.0"), v(sdk, "v1.4.0")},
+			},
+		},
+		{
+			name: "versions other than the selected one",
+			g: &ModuleGraph{
+				Main: main.Path,
+				Selected: map[string]string{
+					"example.com/a": "v1.1.0",
+					sdk:             "v1.7.0",
+				},
+				Requires: map[string][]module.Version{
+					"example.com/provider": {v("example.com/a", "v1.0.0"), v("example.com/a", "v1.1.0")},
+					"example.com/a@v1.0.0": {v(sdk, "v1.0.0")},
+					"example.com/a@v1.1.0": {v("example.com/b", "v1.0.0")},
+					"example.com/b@v1.0.0": {v(sdk, "v1.7.0")},
+				},
+			},
+			want: [][]module.Version{},
+		},
+		{
+			name: "cycle",
+			g: &ModuleGraph{
+				Main: main.Path,
+				Selected: map[string]string{
+					"example.com/a": "v1.0.0",
+					"example.com/b": "v1.0.0",
+					sdk:             "v1.7.0",
+				},
+				Requires: map[string][]module.Version{
+					"example.com/provider": {v("example.com/a", "v1.0.0")},
+					"example.com/a@v1.0.0": {v("example.com/b", "v1.0.0")},
+					"example.com/b@v1.0.0": {v("example.com/a", "v1.0.0"), v(sdk, "v1.6.0")},
+				},
+			},
+			want: [][]module.Version{
+				{main, v("example.com/a", "v1.0.0"), v("example.com/b", "v1.0.0"), v(sdk, "v1.6.0")},
+			},
+		},
+		{
+			name: "sorted by requiring module",
+			g: &ModuleGraph{
+				Main: main.Path,
+				Selected: map[string]string{
+					"example.com/a": "v1.0.0",
+					"example.com/z": "v1.0.0",
+					sdk:             "v1.7.0",
+				},
+				Requires: map[string][]module.Version{
+					"example.com/provider": {v("example.com/z", "v1.0.0"), v("example.com/a", "v1.0.0"), v(sdk, "v1.7.0")},
+					"example.com/a@v1.0.0": {v(sdk, "v1.5.0")},
+					"example.com/z@v1.0.0": {v(sdk, "v1.7.0")},
+				},
+			},
+			want: [][]module.Version{
+				{main, v("example.com/a", "v1.0.0"), v(sdk, "v1.5.0")},
+				{main, v("example.com/z", "v1.0.0"), v(sdk, "v1.7.0")},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.g.ChainsTo(sdk)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("unexpected chains\ngot:  %v\nwant: %v", got, tc.want)
+			}
+		})
+	}
+}
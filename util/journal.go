@@ -0,0 +1,357 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/cli"
+)
+
+// Journal records the original content of every file touched by a run,
+// so that the run can be rolled back after a failure, an interrupt, or
+// by the rollback command once it has completed.
+type Journal struct {
+	Command   string          `json:"command"`
+	Root      string          `json:"root"`
+	StartedAt time.Time       `json:"started_at"`
+	Completed bool            `json:"completed"`
+	Files     []*JournalEntry `json:"files"`
+
+	path string
+}
+
+type JournalEntry struct {
+	Path     string      `json:"path"`
+	Existed  bool        `json:"existed"`
+	Mode     os.FileMode `json:"mode"`
+	Original []byte      `json:"original,omitempty"`
+
+	// Checksum is the SHA-256 of the file content at the end of a
+	// completed run, empty if the file did not exist.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// JournalPath returns the location of the journal for the provider at
+// root. Journals are kept in the user cache directory, so they never
+// end up in the provider's VCS.
+func JournalPath(root string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	sum := sha256.Sum256([]byte(absRoot))
+	name := fmt.Sprintf("journal-%s.json", hex.EncodeToString(sum[:8]))
+	return filepath.Join(dir, "tf-sdk-migrator", name), nil
+}
+
+// LoadJournal reads the journal of the provider at root. The error
+// satisfies os.IsNotExist if there is none.
+func LoadJournal(root string) (*Journal, error) {
+	path, err := JournalPath(root)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{path: path}
+	err = json.Unmarshal(content, j)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse journal %s: %s", path, err)
+	}
+	return j, nil
+}
+
+// Path returns the location of the journal file.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+func (j *Journal) save() error {
+	content, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(j.path), 0700)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(j.path, content, 0600)
+}
+
+func (j *Journal) entry(path string) *JournalEntry {
+	for _, e := range j.Files {
+		if e.Path == path {
+			return e
+		}
+	}
+	return nil
+}
+
+// Modified returns the journaled files whose content has changed since
+// the run completed.
+func (j *Journal) Modified() ([]string, error) {
+	modified := []string{}
+	for _, e := range j.Files {
+		checksum, err := fileChecksum(e.Path)
+		if err != nil {
+			return nil, err
+		}
+		if checksum != e.Checksum {
+			modified = append(modified, e.Path)
+		}
+	}
+	return modified, nil
+}
+
+// Restore puts every journaled file back into its original state and
+// removes the journal.
+func (j *Journal) Restore() error {
+	for i := len(j.Files) - 1; i >= 0; i-- {
+		e := j.Files[i]
+		if !e.Existed {
+			err := os.Remove(e.Path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		err := WriteFileAtomic(e.Path, e.Original, e.Mode)
+		if err != nil {
+			return fmt.Errorf("could not restore %s: %s", e.Path, err)
+		}
+	}
+	return os.Remove(j.path)
+}
+
+func fileChecksum(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Transaction writes files atomically and journals their original
+// content first, so that every file can be restored if any step of a
+// run fails or is interrupted. Should the process die before that, the
+// rollback command restores them from the journal.
+type Transaction struct {
+	mu      sync.Mutex
+	journal *Journal
+	done    bool
+}
+
+// BeginTransaction starts a run against the provider at root. It refuses
+// to start while the journal of an interrupted run is still present.
+func BeginTransaction(root, command string) (*Transaction, error) {
+	existing, err := LoadJournal(root)
+	if err == nil && !existing.Completed {
+		return nil, fmt.Errorf("an unfinished %s run left a journal at %s, please run `tf-sdk-migrator rollback` first",
+			existing.Command, existing.Path())
+	}
+	// the journal may still hold the original content of files, so it is
+	// never overwritten unless it was read
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s; it may hold the original content of files changed by an earlier run, please inspect or delete it", err)
+	}
+
+	path, err := JournalPath(root)
+	if err != nil {
+		return nil, err
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		Command:   command,
+		Root:      absRoot,
+		StartedAt: time.Now().UTC(),
+		Files:     []*JournalEntry{},
+		path:      path,
+	}
+	err = j.save()
+	if err != nil {
+		return nil, fmt.Errorf("could not write journal: %s", err)
+	}
+
+	return &Transaction{journal: j}, nil
+}
+
+// JournalPath returns the location of the journal of the transaction.
+func (tx *Transaction) JournalPath() string {
+	return tx.journal.Path()
+}
+
+// Snapshot journals the current content of paths that are about to be
+// modified by something other than the transaction, e.g. `go mod tidy`.
+func (tx *Transaction) Snapshot(paths ...string) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return tx.snapshot(paths...)
+}
+
+func (tx *Transaction) snapshot(paths ...string) error {
+	added := false
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if tx.journal.entry(path) != nil {
+			continue
+		}
+
+		e := &JournalEntry{Path: path}
+		info, err := os.Stat(path)
+		if err == nil {
+			e.Existed = true
+			e.Mode = info.Mode().Perm()
+			e.Original, err = ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		tx.journal.Files = append(tx.journal.Files, e)
+		added = true
+	}
+	if !added {
+		return nil
+	}
+	return tx.journal.save()
+}
+
+// Apply journals and then writes every change staged in cs.
+func (tx *Transaction) Apply(cs *Changeset) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return fmt.Errorf("transaction already finished")
+	}
+
+	changes := cs.Changes()
+	paths := make([]string, len(changes))
+	for i, fc := range changes {
+		paths[i] = fc.Path
+	}
+	err := tx.snapshot(paths...)
+	if err != nil {
+		return fmt.Errorf("could not write journal: %s", err)
+	}
+
+	for _, fc := range changes {
+		err := WriteFileAtomic(fc.Path, fc.Content, fc.Mode)
+		if err != nil {
+			return fmt.Errorf("could not write %s: %s", fc.Path, err)
+		}
+	}
+	return nil
+}
+
+// Commit marks the run as completed. The journal is kept so that the
+// run can still be undone with the rollback command.
+func (tx *Transaction) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	for _, e := range tx.journal.Files {
+		checksum, err := fileChecksum(e.Path)
+		if err != nil {
+			return err
+		}
+		e.Checksum = checksum
+	}
+	tx.journal.Completed = true
+	tx.done = true
+	return tx.journal.save()
+}
+
+// Rollback restores every file touched by the transaction.
+// It is a no-op if the transaction has already finished.
+func (tx *Transaction) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return tx.rollback()
+}
+
+func (tx *Transaction) rollback() error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	return tx.journal.Restore()
+}
+
+// AbortTransaction reports the error err of a failed step to ui and
+// rolls back every change made so far. It returns the exit status of
+// the command.
+func AbortTransaction(ui cli.Ui, tx *Transaction, msg string, err error) int {
+	ui.Error(fmt.Sprintf("%s: %s", msg, err))
+	reportRollback(ui, tx, tx.Rollback())
+	return 1
+}
+
+// InterruptTransaction is like AbortTransaction, but for a run which was
+// interrupted.
+func InterruptTransaction(ui cli.Ui, tx *Transaction) int {
+	ui.Error("Interrupted.")
+	reportRollback(ui, tx, tx.Rollback())
+	return 1
+}
+
+func reportRollback(ui cli.Ui, tx *Transaction, err error) {
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error rolling back changes: %s\nOriginal file contents are kept in %s.",
+			err, tx.JournalPath()))
+		return
+	}
+	ui.Warn("All changes have been rolled back.")
+}
+
+// WriteFileAtomic writes content to a temporary file next to path and
+// renames it into place, so readers never observe a partial write.
+func WriteFileAtomic(path string, content []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, mode)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestBeginTransactionCorruptJournal(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the user cache directory is only set through XDG_CACHE_HOME on Linux")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "tf-sdk-migrator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldCache := os.Getenv("XDG_CACHE_HOME")
+	defer os.Setenv("XDG_CACHE_HOME", oldCache)
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(tmpDir, "cache"))
+
+	root := filepath.Join(tmpDir, "provider")
+	path, err := JournalPath(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := []byte(`{"command": "migrate", "files": [`)
+	if err := ioutil.WriteFile(path, corrupt, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := BeginTransaction(root, "migrate"); err == nil {
+		t.Fatal("expected an error for a journal which cannot be parsed")
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != string(corrupt) {
+		t.Errorf("the journal was overwritten: %s", content)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := BeginTransaction(root, "migrate")
+	if err != nil {
+		t.Fatalf("unexpected error without a journal: %s", err)
+	}
+	if tx.JournalPath() != path {
+		t.Errorf("unexpected journal path %s, expected %s", tx.JournalPath(), path)
+	}
+}
@@ -0,0 +1,272 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// goProxy returns the configured GOPROXY.
+func (t *Toolchain) goProxy() string {
+	if t != nil && t.GoProxy != "" {
+		return t.GoProxy
+	}
+	return os.Getenv("GOPROXY")
+}
+
+// fileProxies returns the directories of the file:// entries of the
+// configured GOPROXY.
+func (t *Toolchain) fileProxies() []string {
+	var dirs []string
+	for _, entry := range strings.FieldsFunc(t.goProxy(), func(r rune) bool {
+		return r == ',' || r == '|'
+	}) {
+		u, err := url.Parse(strings.TrimSpace(entry))
+		if err != nil || u.Scheme != "file" {
+			continue
+		}
+		dirs = append(dirs, filepath.FromSlash(u.Path))
+	}
+	return dirs
+}
+
+// offlineGoProxy returns the GOPROXY used in offline mode: the file://
+// entries of the configured GOPROXY, or off if there are none.
+func (t *Toolchain) offlineGoProxy() string {
+	var entries []string
+	for _, dir := range t.fileProxies() {
+		entries = append(entries, "file://"+filepath.ToSlash(dir))
+	}
+	if len(entries) == 0 {
+		return "off"
+	}
+	return strings.Join(entries, ",")
+}
+
+// offlineGoFlags returns the configured GOFLAGS with -mod set to mod, so
+// that go.mod and go.sum can be updated from the module cache.
+func (t *Toolchain) offlineGoFlags() string {
+	flags := []string{"-mod=mod"}
+	for _, f := range strings.Fields(t.goFlags()) {
+		if !strings.HasPrefix(f, "-mod=") && !strings.HasPrefix(f, "--mod=") {
+			flags = append(flags, f)
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+// moduleSources returns the directories modules are resolved from in
+// offline mode: file:// proxies first, then the download cache of the
+// module cache, which has the same layout.
+func (t *Toolchain) moduleSources(ctx context.Context) ([]string, error) {
+	out, err := t.Run(ctx, "", "env", "GOMODCACHE", "GOPATH")
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	modCache := strings.TrimSpace(lines[0])
+	if modCache == "" && len(lines) > 1 {
+		// GOMODCACHE was added in Go 1.15
+		gopath := filepath.SplitList(strings.TrimSpace(lines[1]))
+		if len(gopath) > 0 {
+			modCache = filepath.Join(gopath[0], "pkg", "mod")
+		}
+	}
+
+	sources := t.fileProxies()
+	if modCache != "" {
+		sources = append(sources, filepath.Join(modCache, "cache", "download"))
+	}
+	return sources, nil
+}
+
+// ResolveModuleVersion resolves the version query for the module
+// modPath, e.g. v1.7.0, latest or a branch name, to a canonical version
+// or pseudo-version. Queries are resolved by the go tool through GOPROXY
+// and the module cache, or with ResolveModuleOffline in offline mode.
+func (t *Toolchain) ResolveModuleVersion(ctx context.Context, modPath, query string) (string, error) {
+	if t != nil && t.Offline {
+		return t.ResolveModuleOffline(ctx, modPath, query)
+	}
+
+	// resolve from a scratch module, so that GOFLAGS such as -mod=vendor
+	// and the go.mod of the working directory do not interfere
+	tmpDir, err := ioutil.TempDir("", "tf-sdk-migrator")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	err = ioutil.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte("module tf-sdk-migrator-resolve\n"), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := t.WithEnv("GO111MODULE=on").Run(ctx, tmpDir, "list", "-mod=readonly", "-m", "-json", modPath+"@"+query)
+	if err != nil {
+		return "", err
+	}
+	var m struct {
+		Version string
+	}
+	err = json.Unmarshal(out, &m)
+	if err != nil {
+		return "", fmt.Errorf("could not decode go list output: %s", err)
+	}
+	if !semver.IsValid(m.Version) {
+		return "", fmt.Errorf("%s@%s resolved to invalid version %q", modPath, query, m.Version)
+	}
+	return m.Version, nil
+}
+
+// ResolveModuleOffline resolves version of the module modPath without
+// network access, from the module cache or a file:// GOPROXY. version
+// is either a semantic version (including pseudo-versions), which must
+// be available, or latest, which selects the highest available release.
+// Branch names and other queries cannot be resolved offline.
+func (t *Toolchain) ResolveModuleOffline(ctx context.Context, modPath, version string) (string, error) {
+	if version != "latest" && (!semver.IsValid(version) || semver.Canonical(version) != version) {
+		return "", fmt.Errorf("%s cannot be resolved offline: use a version such as v1.7.0, or latest", version)
+	}
+
+	escPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return "", err
+	}
+	sources, err := t.moduleSources(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var available []string
+	for _, source := range sources {
+		dir := filepath.Join(source, filepath.FromSlash(escPath), "@v")
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		for _, info := range infos {
+			escVersion := strings.TrimSuffix(info.Name(), ".zip")
+			if escVersion == info.Name() {
+				continue
+			}
+			v, err := module.UnescapeVersion(escVersion)
+			if err != nil || !semver.IsValid(v) {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(dir, escVersion+".mod")); err != nil {
+				continue
+			}
+			available = append(available, v)
+		}
+	}
+
+	var resolved string
+	for _, v := range available {
+		if version != "latest" {
+			if v == version {
+				return v, nil
+			}
+			continue
+		}
+		if resolved == "" || newerRelease(v, resolved) {
+			resolved = v
+		}
+	}
+	if resolved == "" {
+		return "", fmt.Errorf("%s@%s is not available offline, looked in: %s",
+			modPath, version, strings.Join(sources, ", "))
+	}
+	return resolved, nil
+}
+
+// newerRelease reports whether v is preferred over than as the latest
+// version: releases are preferred over prereleases, and higher versions
+// over lower ones.
+func newerRelease(v, than string) bool {
+	vPre, thanPre := semver.Prerelease(v) != "", semver.Prerelease(than) != ""
+	if vPre != thanPre {
+		return !vPre
+	}
+	return semver.Compare(v, than) > 0
+}
+
+// PrettyVersion returns the resolved module version, along with the
+// version query it was resolved from if they differ.
+func PrettyVersion(version, query string) string {
+	if version == query {
+		return version
+	}
+	return fmt.Sprintf("%s (resolved from %s)", version, query)
+}
+
+// MissingModules returns the modules in the module graph of the
+// provider, with the changes staged in cs applied, which are not
+// available offline, each described by path@version followed by the
+// error. The module graph is loaded in a scratch directory, leaving the
+// provider untouched.
+func MissingModules(ctx context.Context, tc *Toolchain, cs *Changeset, providerPath string) ([]string, error) {
+	tmpDir, err := ioutil.TempDir("", "tf-sdk-migrator")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, name := range []string{"go.mod", "go.sum"} {
+		content, err := cs.ReadFile(filepath.Join(providerPath, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = ioutil.WriteFile(filepath.Join(tmpDir, name), content, 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = absLocalReplacements(filepath.Join(tmpDir, "go.mod"), providerPath)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := tc.Run(ctx, tmpDir, "list", "-mod=mod", "-m", "-e", "-json", "all")
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var m struct {
+			Path    string
+			Version string
+			Error   *struct {
+				Err string
+			}
+		}
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("could not decode go list output: %s", err)
+		}
+		if m.Error == nil {
+			continue
+		}
+		msg := m.Error.Err
+		if !strings.HasPrefix(msg, m.Path+"@") {
+			msg = fmt.Sprintf("%s@%s: %s", m.Path, m.Version, msg)
+		}
+		missing = append(missing, msg)
+	}
+	return missing, nil
+}
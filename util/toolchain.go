@@ -0,0 +1,276 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultGoTimeout is the default time limit for a single invocation of
+// the go tool.
+const DefaultGoTimeout = 10 * time.Minute
+
+// Toolchain runs the go tool on behalf of the migrator. The zero value
+// runs go from PATH in the inherited environment, without a timeout.
+type Toolchain struct {
+	// GoBin is the go binary to run. Defaults to go on PATH.
+	GoBin string
+
+	// GoFlags, GoProxy and GoPrivate, if set, override GOFLAGS, GOPROXY
+	// and GOPRIVATE in the environment of the go tool.
+	GoFlags   string
+	GoProxy   string
+	GoPrivate string
+
+	// Env holds additional environment variables, in the form
+	// KEY=value.
+	Env []string
+
+	// Timeout limits the duration of a single invocation. Zero means no
+	// limit.
+	Timeout time.Duration
+
+	// Offline prevents the go tool from accessing the network: modules
+	// are only resolved from the module cache or file:// entries of
+	// GOPROXY, and go.mod may be updated from them.
+	Offline bool
+}
+
+// NewToolchain returns a Toolchain running go from PATH with the default
+// timeout.
+func NewToolchain() *Toolchain {
+	return &Toolchain{GoBin: "go", Timeout: DefaultGoTimeout}
+}
+
+// AddFlags registers the --go-bin, --goflags, --goproxy, --goprivate and
+// --go-timeout flags, which configure t.
+func (t *Toolchain) AddFlags(flags *flag.FlagSet) {
+	flags.StringVar(&t.GoBin, "go-bin", t.GoBin, "Go binary used to build the provider")
+	flags.StringVar(&t.GoFlags, "goflags", t.GoFlags, "GOFLAGS for the go tool, overriding the environment")
+	flags.StringVar(&t.GoProxy, "goproxy", t.GoProxy, "GOPROXY for the go tool, overriding the environment")
+	flags.StringVar(&t.GoPrivate, "goprivate", t.GoPrivate, "GOPRIVATE for the go tool, overriding the environment")
+	flags.DurationVar(&t.Timeout, "go-timeout", t.Timeout, "Time limit for each invocation of the go tool, 0 for none")
+}
+
+// GoBinary returns the go binary run by t.
+func (t *Toolchain) GoBinary() string {
+	if t == nil || t.GoBin == "" {
+		return "go"
+	}
+	return t.GoBin
+}
+
+// WithEnv returns a copy of t which additionally sets the environment
+// variables env, in the form KEY=value.
+func (t *Toolchain) WithEnv(env ...string) *Toolchain {
+	c := Toolchain{}
+	if t != nil {
+		c = *t
+	}
+	c.Env = append(append([]string{}, c.Env...), env...)
+	return &c
+}
+
+// Environ returns the environment the go tool is run in.
+func (t *Toolchain) Environ() []string {
+	env := os.Environ()
+	if t == nil {
+		return env
+	}
+	if t.Offline {
+		// the checksum database and newer toolchains cannot be
+		// downloaded either; modules are still checked against go.sum
+		env = append(env, "GOFLAGS="+t.offlineGoFlags(), "GOPROXY="+t.offlineGoProxy(),
+			"GOSUMDB=off", "GOTOOLCHAIN=local")
+	} else {
+		if t.GoFlags != "" {
+			env = append(env, "GOFLAGS="+t.GoFlags)
+		}
+		if t.GoProxy != "" {
+			env = append(env, "GOPROXY="+t.GoProxy)
+		}
+	}
+	if t.GoPrivate != "" {
+		env = append(env, "GOPRIVATE="+t.GoPrivate)
+	}
+	return append(env, t.Env...)
+}
+
+// PathEnviron returns Environ with the directory of the go binary
+// prepended to PATH, for libraries which run go from PATH, such as
+// go/packages.
+func (t *Toolchain) PathEnviron() []string {
+	env := t.Environ()
+	bin := t.GoBinary()
+	if path, err := exec.LookPath(bin); err == nil {
+		bin = path
+	}
+	if strings.TrimSuffix(filepath.Base(bin), ".exe") != "go" {
+		log.Printf("[WARN] %s is not named go, so go from PATH is used to load packages", bin)
+		return env
+	}
+	return append(env, "PATH="+filepath.Dir(bin)+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// goFlags returns the effective GOFLAGS.
+func (t *Toolchain) goFlags() string {
+	if t != nil && t.GoFlags != "" {
+		return t.GoFlags
+	}
+	return os.Getenv("GOFLAGS")
+}
+
+// ModFlags returns the -mod flag for building the packages in dir:
+// vendor if their module has a vendor/modules.txt, readonly otherwise.
+// No flag is returned if GOFLAGS already sets -mod.
+func (t *Toolchain) ModFlags(dir string) []string {
+	for _, f := range strings.Fields(t.goFlags()) {
+		if strings.HasPrefix(f, "-mod=") || strings.HasPrefix(f, "--mod=") {
+			return nil
+		}
+	}
+
+	if m, err := FindEnclosingModule(dir); err == nil && m != nil {
+		dir = m.Dir
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "vendor", "modules.txt")); err == nil {
+		return []string{"-mod=vendor"}
+	}
+	return []string{"-mod=readonly"}
+}
+
+// Run runs the go tool with args in dir and returns its standard output.
+// If it fails, the error is an *ExecError.
+func (t *Toolchain) Run(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if t != nil && t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, t.GoBinary(), args...)
+	cmd.Env = t.Environ()
+	cmd.Dir = dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	log.Printf("[DEBUG] Executing command %s %q in %s", t.GoBinary(), args, dir)
+	start := time.Now()
+	err := cmd.Run()
+	log.Printf("[DEBUG] Command %s %q finished after %s", t.GoBinary(), args, time.Since(start))
+	if err != nil {
+		ee := &ExecError{
+			Args:     append([]string{t.GoBinary()}, args...),
+			Dir:      dir,
+			ExitCode: -1,
+			Stderr:   strings.TrimSpace(stderr.String()),
+			Err:      err,
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			ee.ExitCode = exitErr.ExitCode()
+		}
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			ee.TimedOut = true
+			if t != nil {
+				ee.Timeout = t.Timeout
+			}
+		case context.Canceled:
+			ee.Canceled = true
+		}
+		return stdout.Bytes(), ee
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// ExecError describes a failed invocation of an external command.
+type ExecError struct {
+	// Args holds the command and its arguments.
+	Args []string
+	Dir  string
+
+	// ExitCode is the exit code of the command, or -1 if it did not
+	// exit normally, e.g. because it could not be started or was killed.
+	ExitCode int
+
+	// Stderr holds the standard error output of the command.
+	Stderr string
+
+	// TimedOut is set if the command was killed after Timeout, Canceled
+	// if it was killed because the run was cancelled.
+	TimedOut bool
+	Timeout  time.Duration
+	Canceled bool
+
+	Err error
+}
+
+func (ee *ExecError) Error() string {
+	var msg string
+	switch {
+	case ee.TimedOut:
+		msg = fmt.Sprintf("`%s` timed out after %s", strings.Join(ee.Args, " "), ee.Timeout)
+	case ee.Canceled:
+		msg = fmt.Sprintf("`%s` was cancelled", strings.Join(ee.Args, " "))
+	default:
+		msg = fmt.Sprintf("`%s` failed: %s", strings.Join(ee.Args, " "), ee.Err)
+	}
+	if ee.Stderr != "" {
+		msg += "\n" + ee.Stderr
+	}
+	return msg
+}
+
+// InterruptContext returns a context which is cancelled when the process
+// receives SIGINT or SIGTERM, so that running commands are stopped. The
+// returned function releases the signal handler.
+func InterruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// HasVendorFolder reports whether the module at providerPath vendors
+// its dependencies.
+func HasVendorFolder(providerPath string) (bool, error) {
+	vendorPath := filepath.Join(providerPath, "vendor")
+	fs, err := os.Stat(vendorPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !fs.Mode().IsDir() {
+		return false, fmt.Errorf("%s is not folder (expected folder)", vendorPath)
+	}
+
+	return true, nil
+}
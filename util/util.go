@@ -1,8 +1,8 @@
 package util
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"go/parser"
 	"go/printer"
@@ -10,12 +10,12 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 
 	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
 )
 
 var printConfig = printer.Config{
@@ -92,10 +92,22 @@ func GetProviderPath(providerRepoName string) (string, error) {
 	return "", fmt.Errorf("Could not find %s in working directory or GOPATH: %s", providerRepoName, gopath)
 }
 
-func RewriteGoMod(providerPath string, sdkVersion string, oldPackagePath string, newPackagePath string) error {
+func RewriteGoMod(cs *Changeset, providerPath string, sdkVersion string, oldPackagePath string, newPackagePath string) error {
+	return rewriteGoMod(cs, providerPath, sdkVersion, oldPackagePath, newPackagePath, true)
+}
+
+// RewriteSharedGoMod is like RewriteGoMod for the go.mod in modulePath
+// of a module which the provider is only a part of. Packages outside of
+// the provider may still depend on oldPackagePath, so its requirement is
+// kept, and dropped by `go mod tidy` if it is no longer used.
+func RewriteSharedGoMod(cs *Changeset, modulePath string, sdkVersion string, oldPackagePath string, newPackagePath string) error {
+	return rewriteGoMod(cs, modulePath, sdkVersion, oldPackagePath, newPackagePath, false)
+}
+
+func rewriteGoMod(cs *Changeset, providerPath string, sdkVersion string, oldPackagePath string, newPackagePath string, dropOld bool) error {
 	goModPath := filepath.Join(providerPath, "go.mod")
 
-	input, err := ioutil.ReadFile(goModPath)
+	input, err := cs.ReadFile(goModPath)
 	if err != nil {
 		return err
 	}
@@ -105,94 +117,223 @@ func RewriteGoMod(providerPath string, sdkVersion string, oldPackagePath string,
 		return err
 	}
 
-	err = pf.DropRequire(oldPackagePath)
+	if dropOld {
+		err = pf.DropRequire(oldPackagePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	// a shared module may already require a newer version of the SDK
+	for _, r := range pf.Require {
+		if !dropOld && r.Mod.Path == newPackagePath && semver.Compare(r.Mod.Version, sdkVersion) > 0 {
+			log.Printf("[INFO] Keeping %s %s required by %s, which is newer than %s", newPackagePath, r.Mod.Version, goModPath, sdkVersion)
+			sdkVersion = r.Mod.Version
+		}
+	}
+	err = pf.AddRequire(newPackagePath, sdkVersion)
 	if err != nil {
 		return err
 	}
 
-	pf.AddNewRequire(newPackagePath, sdkVersion, false)
-
 	pf.Cleanup()
 	formattedOutput, err := pf.Format()
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(goModPath, formattedOutput, 0644)
-	if err != nil {
-		return err
-	}
+	return cs.WriteFile(goModPath, formattedOutput)
+}
 
-	return nil
+// RewriteImports stages import path rewrites for every .go file
+// under providerPath, skipping vendored dependencies and nested modules,
+// which are rewritten separately. rewrites maps old import path
+// prefixes to their replacement.
+func RewriteImports(cs *Changeset, providerPath string, rewrites map[string]string) error {
+	return filepath.Walk(providerPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && (info.Name() == "vendor" || path != providerPath && HasGoMod(path)) {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".go") {
+			err := RewriteImportedPackageImports(cs, path, rewrites)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func RewriteImportedPackageImports(filePath string, stringToReplace string, replacement string) error {
-	if _, err := os.Stat(filePath); err != nil {
+// RewriteImportedPackageImports stages import path rewrites for a single
+// file. When several prefixes in rewrites match an import, the longest
+// one wins. Imports which already start with the replacement of a
+// prefix are not rewritten by it, e.g. imports of a /v2 module below
+// the module it replaces.
+func RewriteImportedPackageImports(cs *Changeset, filePath string, rewrites map[string]string) error {
+	src, err := cs.ReadFile(filePath)
+	if err != nil {
 		return err
 	}
 
 	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, filePath, nil, parser.ParseComments)
+	f, err := parser.ParseFile(fset, filePath, src, parser.ParseComments)
 	if err != nil {
 		return err
 	}
 
+	rewritten := false
 	for _, impSpec := range f.Imports {
 		impPath, err := strconv.Unquote(impSpec.Path.Value)
 		if err != nil {
 			log.Print(err)
 		}
-		// prevent partial matches on package names
-		if impPath == stringToReplace || strings.HasPrefix(impPath, stringToReplace+"/") {
-			newImpPath := strings.Replace(impPath, stringToReplace, replacement, -1)
+
+		stringToReplace := ""
+		for prefix, replacement := range rewrites {
+			// prevent partial matches on package names
+			if hasImportPathPrefix(impPath, prefix) && !hasImportPathPrefix(impPath, replacement) {
+				if len(prefix) > len(stringToReplace) {
+					stringToReplace = prefix
+				}
+			}
+		}
+		if stringToReplace != "" {
+			newImpPath := rewrites[stringToReplace] + strings.TrimPrefix(impPath, stringToReplace)
 			impSpec.Path.Value = strconv.Quote(newImpPath)
+			rewritten = true
 		}
 	}
+	if !rewritten {
+		return nil
+	}
 
-	out, err := os.Create(filePath)
+	content, err := FormatFile(fset, f)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-	w := bufio.NewWriter(out)
-	if err := printConfig.Fprint(w, fset, f); err != nil {
+
+	return cs.WriteFile(filePath, content)
+}
+
+// hasImportPathPrefix reports whether importPath is prefix or a package
+// below it.
+func hasImportPathPrefix(importPath, prefix string) bool {
+	return importPath == prefix || strings.HasPrefix(importPath, prefix+"/")
+}
+
+// GoModTidyPreview runs `go mod tidy` against a scratch copy of the
+// provider with all staged changes applied, and stages the resulting
+// go.mod and go.sum, leaving the provider itself untouched.
+func GoModTidyPreview(ctx context.Context, tc *Toolchain, cs *Changeset, providerPath string) error {
+	tmpDir, err := ioutil.TempDir("", "tf-sdk-migrator")
+	if err != nil {
 		return err
 	}
-	if err := w.Flush(); err != nil {
+	defer os.RemoveAll(tmpDir)
+
+	err = filepath.Walk(providerPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(providerPath, path)
+		if err != nil {
+			return err
+		}
+		tmpPath := filepath.Join(tmpDir, relPath)
+
+		if info.IsDir() {
+			if path != providerPath && (info.Name() == "vendor" || info.Name() == ".git") {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(tmpPath, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		content, err := cs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(tmpPath, content, info.Mode().Perm())
+	})
+	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func GoModTidy(providerPath string) error {
-	args := []string{"go", "mod", "tidy"}
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Env = os.Environ()
-	cmd.Dir = providerPath
+	tmpGoModPath := filepath.Join(tmpDir, "go.mod")
+	localReplacements, err := absLocalReplacements(tmpGoModPath, providerPath)
+	if err != nil {
+		return err
+	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	err = GoModTidy(ctx, tc, tmpDir)
+	if err != nil {
+		return err
+	}
 
-	log.Printf("[DEBUG] Executing command %q", args)
-	err := cmd.Run()
+	goMod, err := ioutil.ReadFile(tmpGoModPath)
 	if err != nil {
-		return NewExecError(err, stderr.String())
+		return err
+	}
+	for relPath, absPath := range localReplacements {
+		goMod = bytes.Replace(goMod, []byte(absPath), []byte(relPath), -1)
+	}
+	err = cs.WriteFile(filepath.Join(providerPath, "go.mod"), goMod)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	goSum, err := ioutil.ReadFile(filepath.Join(tmpDir, "go.sum"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return cs.WriteFile(filepath.Join(providerPath, "go.sum"), goSum)
 }
 
-type ExecError struct {
-	Err    error
-	Stderr string
-}
+// absLocalReplacements rewrites relative local replace directives in
+// the go.mod at goModPath to absolute paths under providerPath, so they
+// still resolve from a scratch copy. It returns the original paths
+// mapped to their absolute equivalents.
+func absLocalReplacements(goModPath, providerPath string) (map[string]string, error) {
+	input, err := ioutil.ReadFile(goModPath)
+	if err != nil {
+		return nil, err
+	}
+	pf, err := modfile.Parse(goModPath, input, nil)
+	if err != nil {
+		return nil, err
+	}
 
-func (ee *ExecError) Error() string {
-	return fmt.Sprintf("%s\n%s", ee.Err, ee.Stderr)
+	replacements := make(map[string]string)
+	for _, r := range pf.Replace {
+		if r.New.Version != "" || filepath.IsAbs(r.New.Path) {
+			continue
+		}
+		absPath := filepath.Join(providerPath, r.New.Path)
+		// the replacement path is the last token of a local replace
+		r.Syntax.Token[len(r.Syntax.Token)-1] = modfile.AutoQuote(absPath)
+		replacements[r.New.Path] = absPath
+	}
+	if len(replacements) == 0 {
+		return replacements, nil
+	}
+
+	output, err := pf.Format()
+	if err != nil {
+		return nil, err
+	}
+	return replacements, ioutil.WriteFile(goModPath, output, 0644)
 }
 
-func NewExecError(err error, stderr string) *ExecError {
-	return &ExecError{err, stderr}
+// GoModTidy runs `go mod tidy` in providerPath.
+func GoModTidy(ctx context.Context, tc *Toolchain, providerPath string) error {
+	_, err := tc.Run(ctx, providerPath, "mod", "tidy")
+	return err
 }
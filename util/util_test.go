@@ -0,0 +1,57 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewriteImportedPackageImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tf-sdk-migrator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "provider.go")
+	src := `package provider
+
+import (
+	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdkx/foo"
+	"github.com/hashicorp/terraform/helper/resource"
+)
+`
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := NewChangeset()
+	rewrites := map[string]string{
+		"github.com/hashicorp/terraform-plugin-sdk":                "github.com/hashicorp/terraform-plugin-sdk/v2",
+		"github.com/hashicorp/terraform":                           "github.com/hashicorp/terraform-plugin-sdk",
+		"github.com/hashicorp/terraform/helper/resource/unmatched": "example.com/unused",
+	}
+	if err := RewriteImportedPackageImports(cs, path, rewrites); err != nil {
+		t.Fatal(err)
+	}
+	got, err := cs.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `package provider
+
+import (
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdkx/foo"
+	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
+)
+`
+	if string(got) != want {
+		t.Errorf("unexpected rewrite:\n%s", UnifiedDiff("want", "got", []byte(want), got))
+	}
+}
@@ -0,0 +1,212 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Module is a Go module found in a provider repository.
+type Module struct {
+	// Dir is the directory containing the go.mod of the module.
+	Dir string
+
+	// Path is the module path declared in go.mod.
+	Path string
+}
+
+// RelativePath returns dir relative to the provider root, for display.
+func RelativePath(providerPath, dir string) string {
+	rel, err := filepath.Rel(providerPath, dir)
+	if err != nil {
+		return dir
+	}
+	return rel
+}
+
+// ModuleDescription describes m for display: the provider, or the
+// module in a provider with several modules.
+func ModuleDescription(providerPath string, m *Module, multiModule bool) string {
+	if !multiModule {
+		return "the provider"
+	}
+	if m.Dir == providerPath {
+		return fmt.Sprintf("module %s", m.Path)
+	}
+	return fmt.Sprintf("module %s in %s", m.Path, RelativePath(providerPath, m.Dir))
+}
+
+// HasGoMod reports whether dir contains a go.mod file.
+func HasGoMod(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "go.mod"))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// FindEnclosingModule returns the module containing dir: the module in
+// dir itself, or in the nearest parent directory with a go.mod, e.g.
+// when a provider is a subdirectory of a larger module. It returns nil
+// if dir is not part of a module.
+func FindEnclosingModule(dir string) (*Module, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if HasGoMod(dir) {
+			content, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+			if err != nil {
+				return nil, err
+			}
+			return &Module{Dir: dir, Path: modfile.ModulePath(content)}, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// Contains reports whether dir is m.Dir or one of its subdirectories.
+func (m *Module) Contains(dir string) bool {
+	rel, err := filepath.Rel(m.Dir, dir)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// skipDir reports whether the go tool ignores the directory named name
+// when matching packages, or it holds vendored dependencies.
+func skipDir(name string) bool {
+	return name == "vendor" || name == "testdata" ||
+		strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// FindModules returns every module in the repository at root: the
+// module at root itself, modules in subdirectories, and the members of
+// a go.work workspace at root, which may be outside of it. Vendored
+// dependencies and directories ignored by the go tool are not searched.
+// The module at root, if any, comes first.
+func FindModules(root string) ([]*Module, error) {
+	dirs := make(map[string]bool)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != root && skipDir(info.Name()) {
+			return filepath.SkipDir
+		}
+		if HasGoMod(path) {
+			dirs[path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uses, err := ReadGoWorkUses(root)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, dir := range uses {
+		if HasGoMod(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	modules := make([]*Module, 0, len(dirs))
+	for dir := range dirs {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, &Module{
+			Dir:  dir,
+			Path: modfile.ModulePath(content),
+		})
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		if (modules[i].Dir == root) != (modules[j].Dir == root) {
+			return modules[i].Dir == root
+		}
+		return modules[i].Dir < modules[j].Dir
+	})
+	return modules, nil
+}
+
+// ReadGoWorkUses returns the directories of the modules listed in use
+// directives of the go.work file at root.
+func ReadGoWorkUses(root string) ([]string, error) {
+	goWorkPath := filepath.Join(root, "go.work")
+	content, err := ioutil.ReadFile(goWorkPath)
+	if err != nil {
+		return nil, err
+	}
+	wf, err := modfile.ParseWork(goWorkPath, content, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, u := range wf.Use {
+		dir := filepath.FromSlash(u.Path)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(root, dir)
+		}
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	return dirs, nil
+}
+
+// RequiresModule reports whether the go.mod in dir requires modPath.
+func RequiresModule(dir, modPath string) (bool, error) {
+	goModPath := filepath.Join(dir, "go.mod")
+	content, err := ioutil.ReadFile(goModPath)
+	if err != nil {
+		return false, err
+	}
+	pf, err := modfile.Parse(goModPath, content, nil)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range pf.Require {
+		if r.Mod.Path == modPath {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FindModulesRequiring returns the modules found by FindModules which
+// require modPath.
+func FindModulesRequiring(root, modPath string) ([]*Module, error) {
+	modules, err := FindModules(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var requiring []*Module
+	for _, m := range modules {
+		requires, err := RequiresModule(m.Dir, modPath)
+		if err != nil {
+			return nil, err
+		}
+		if requires {
+			requiring = append(requiring, m)
+		}
+	}
+	return requiring, nil
+}
@@ -0,0 +1,269 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTree writes files, by slash-separated path relative to dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// moduleDirs returns the directories of modules relative to dir, with
+// slashes, each followed by its module path.
+func moduleDirs(t *testing.T, dir string, modules []*Module) []string {
+	t.Helper()
+	dirs := []string{}
+	for _, m := range modules {
+		rel, err := filepath.Rel(dir, m.Dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dirs = append(dirs, filepath.ToSlash(rel)+" "+m.Path)
+	}
+	return dirs
+}
+
+func TestFindModules(t *testing.T) {
+	cases := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "single module",
+			files: map[string]string{
+				"repo/go.mod":          "module example.com/provider\n",
+				"repo/internal/foo.go": "package internal\n",
+			},
+			want: []string{"repo example.com/provider"},
+		},
+		{
+			name: "nested modules",
+			files: map[string]string{
+				"repo/go.mod":               "module example.com/provider\n",
+				"repo/tools/go.mod":         "module example.com/provider/tools\n",
+				"repo/b/go.mod":             "module example.com/provider/b\n",
+				"repo/b/nested/deep/go.mod": "module example.com/provider/b/nested/deep\n",
+			},
+			want: []string{
+				"repo example.com/provider",
+				"repo/b example.com/provider/b",
+				"repo/b/nested/deep example.com/provider/b/nested/deep",
+				"repo/tools example.com/provider/tools",
+			},
+		},
+		{
+			name: "no module at root",
+			files: map[string]string{
+				"repo/a/go.mod": "module example.com/a\n",
+				"repo/b/go.mod": "module example.com/b\n",
+			},
+			want: []string{"repo/a example.com/a", "repo/b example.com/b"},
+		},
+		{
+			name: "vendor and ignored directories",
+			files: map[string]string{
+				"repo/go.mod":                          "module example.com/provider\n",
+				"repo/vendor/example.com/dep/go.mod":   "module example.com/dep\n",
+				"repo/sub/vendor/example.com/x/go.mod": "module example.com/x\n",
+				"repo/testdata/go.mod":                 "module example.com/testdata\n",
+				"repo/.git/go.mod":                     "module example.com/hidden\n",
+				"repo/_old/go.mod":                     "module example.com/old\n",
+			},
+			want: []string{"repo example.com/provider"},
+		},
+		{
+			name: "go.work",
+			files: map[string]string{
+				"repo/go.mod":       "module example.com/provider\n",
+				"repo/tools/go.mod": "module example.com/provider/tools\n",
+				"repo/go.work": `go 1.22
+
+// the provider and its tools
+use (
+	. // root
+	./tools
+	../shared // outside of the repository
+	./missing
+)
+`,
+				"shared/go.mod": "module example.com/shared\n",
+			},
+			want: []string{
+				"repo example.com/provider",
+				"repo/tools example.com/provider/tools",
+				"shared example.com/shared",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "tf-sdk-migrator-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			writeTree(t, dir, tc.files)
+
+			modules, err := FindModules(filepath.Join(dir, "repo"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := moduleDirs(t, dir, modules); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("unexpected modules\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadGoWorkUses(t *testing.T) {
+	cases := []struct {
+		name   string
+		goWork string
+		want   []string
+	}{
+		{
+			name:   "single use",
+			goWork: "go 1.22\n\nuse ./provider\n",
+			want:   []string{"repo/provider"},
+		},
+		{
+			name: "use block with comments",
+			goWork: `// workspace of the provider
+go 1.22
+
+use (
+	// the provider itself
+	.
+	./tools // code generators
+	../shared
+)
+
+use ./docs
+`,
+			want: []string{"repo", "repo/tools", "shared", "repo/docs"},
+		},
+		{
+			name:   "no use directives",
+			goWork: "go 1.22\n",
+			want:   []string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "tf-sdk-migrator-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			writeTree(t, dir, map[string]string{"repo/go.work": tc.goWork})
+
+			uses, err := ReadGoWorkUses(filepath.Join(dir, "repo"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, use := range uses {
+				rel, err := filepath.Rel(dir, use)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("unexpected uses\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("no go.work", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "tf-sdk-migrator-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if _, err := ReadGoWorkUses(dir); !os.IsNotExist(err) {
+			t.Errorf("expected a not exist error, got %v", err)
+		}
+	})
+}
+
+func TestFindModulesRequiring(t *testing.T) {
+	sdk := "github.com/hashicorp/terraform-plugin-sdk"
+
+	cases := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "nested modules",
+			files: map[string]string{
+				"repo/go.mod": "module example.com/provider\n\nrequire " + sdk + " v1.7.0\n",
+				"repo/tools/go.mod": `module example.com/provider/tools
+
+require (
+	// only the generator still uses the SDK
+	example.com/generator v0.1.0
+	` + sdk + ` v1.4.0 // indirect
+)
+`,
+				"repo/other/go.mod": "module example.com/provider/other\n\nrequire " + sdk + "/v2 v2.0.0\n",
+			},
+			want: []string{"repo example.com/provider", "repo/tools example.com/provider/tools"},
+		},
+		{
+			name: "replace only",
+			files: map[string]string{
+				"repo/go.mod": "module example.com/provider\n\nreplace " + sdk + " => ../sdk\n",
+			},
+			want: []string{},
+		},
+		{
+			name: "vendored and workspace modules",
+			files: map[string]string{
+				"repo/go.mod":                    "module example.com/provider\n",
+				"repo/vendor/" + sdk + "/go.mod": "module " + sdk + "\n\nrequire " + sdk + " v1.0.0\n",
+				"repo/go.work":                   "go 1.22\n\nuse (\n\t.\n\t../lib // shared library\n)\n",
+				"lib/go.mod":                     "module example.com/lib\n\nrequire " + sdk + " v1.7.0\n",
+			},
+			want: []string{"lib example.com/lib"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "tf-sdk-migrator-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			writeTree(t, dir, tc.files)
+
+			modules, err := FindModulesRequiring(filepath.Join(dir, "repo"), sdk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := moduleDirs(t, dir, modules); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("unexpected modules\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+}